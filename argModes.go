@@ -0,0 +1,134 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ways to pass the arguments to a command
+const (
+	// declare the arguments as variables at the beginning of the script
+	argModeInject = "inject"
+
+	// export the arguments as ZEUS_ARG_<NAME> environment variables
+	argModeEnv = "env"
+
+	// write the arguments and globals to a JSON file, whose path is passed in ZEUS_ARGS_FILE
+	argModeJSON = "json"
+)
+
+// environment variables for the env and json modes
+const (
+	argEnvPrefix = "ZEUS_ARG_"
+	argNamesEnv  = "ZEUS_ARGS"
+	argsFileEnv  = "ZEUS_ARGS_FILE"
+)
+
+// argsFile is the content of the file passed to commands in json mode
+type argsFile struct {
+	Args    map[string]interface{} `json:"args"`
+	Globals map[string]interface{} `json:"globals"`
+}
+
+// validate an argMode, name is used for the error messages
+func validateArgMode(mode, name string) error {
+	switch mode {
+	case "", argModeInject, argModeEnv, argModeJSON:
+		return nil
+	}
+	return errors.New("invalid argMode " + name + ": " + mode + ", expected env, json or inject")
+}
+
+// the argMode of the command overwrites the one of its language,
+// arguments are injected by default
+func (c *command) argumentMode(lang *Language) string {
+	if c.argMode != "" {
+		return c.argMode
+	}
+	if lang.ArgMode != "" {
+		return lang.ArgMode
+	}
+	return argModeInject
+}
+
+// environment variables for the arguments in env mode.
+// the names of the arguments are passed in ZEUS_ARGS, separated by commas
+func (c *command) argEnv(argValues map[string]string) []string {
+
+	var (
+		env    []string
+		names  []string
+		values = c.joinArgs(argValues)
+	)
+	for _, a := range c.args {
+		env = append(env, argEnvPrefix+strings.ToUpper(a.name)+"="+unquote(values[a.name]))
+		names = append(names, a.name)
+	}
+
+	return append(env, argNamesEnv+"="+strings.Join(names, ","))
+}
+
+// write the typed arguments and globals to a file for the json mode and return its path.
+// the file is only readable by the user, since it can contain secrets
+func (c *command) writeArgsFile(argValues map[string]string) (string, error) {
+
+	data := &argsFile{
+		Args:    make(map[string]interface{}),
+		Globals: make(map[string]interface{}),
+	}
+
+	for _, a := range c.args {
+		data.Args[a.name] = a.argType.typedValue(argValues[a.name])
+	}
+
+	vars, values := g.snapshot()
+	for name, value := range vars {
+		if gl, ok := values[name]; ok {
+			data.Globals[name] = gl.typed()
+		} else {
+			data.Globals[name] = value
+		}
+	}
+
+	contents, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	// the file is created below the zeus directory, because sandboxes have a private /tmp
+	os.MkdirAll(scriptDir+"/.tmp", 0700)
+	f, err := os.CreateTemp(scriptDir+"/.tmp", c.name+"_*.json")
+	if err != nil {
+		return "", errors.New("failed to create arguments file: " + err.Error())
+	}
+	defer f.Close()
+
+	_, err = f.Write(contents)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.New("failed to write arguments file: " + err.Error())
+	}
+
+	return filepath.Abs(f.Name())
+}
@@ -0,0 +1,476 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kinds of paths for the Path type
+const (
+	pathFile = "file"
+	pathDir  = "dir"
+)
+
+// suffix of variadic arguments, which collect repeated values into a list: pkg:String...
+const variadicSuffix = "..."
+
+// length constraint of the String type, e.g. 3..20
+var lengthRangeRegex = regexp.MustCompile(`^(\d*)\.\.(\d*)$`)
+
+// argType is the type of a command argument, including its constraints
+type argType struct {
+
+	// String, Int, Bool, Float, Enum, List, Path, Duration or Secret
+	name string
+
+	// declaration from the commandsFile, e.g. Enum(dev|prod)
+	decl string
+
+	// allowed values of an Enum
+	values []string
+
+	// type of the elements of a List
+	elem *argType
+
+	// variadic arguments are Lists that can be passed multiple times
+	variadic bool
+
+	// Path must be a file or dir, empty if both are allowed
+	pathKind string
+
+	// length limits of a String, -1 if not set
+	minLen, maxLen int
+
+	// pattern a String must match
+	pattern *regexp.Regexp
+}
+
+// parse a type declaration like String(3..20), Enum(a|b), List<Int>, Path(dir) or String...
+func parseArgType(decl string) (*argType, error) {
+
+	var (
+		t = &argType{
+			decl:   decl,
+			minLen: -1,
+			maxLen: -1,
+		}
+		i = strings.IndexAny(decl, "(<")
+	)
+
+	// a variadic argument is a list of its element type
+	if strings.HasSuffix(decl, variadicSuffix) {
+		elem, err := parseArgType(strings.TrimSuffix(decl, variadicSuffix))
+		if err != nil {
+			return nil, err
+		}
+		if elem.name == argTypeList {
+			return nil, errors.New("variadic lists are not supported: " + decl)
+		}
+		t.name = argTypeList
+		t.elem = elem
+		t.variadic = true
+		return t, nil
+	}
+
+	t.name = decl
+	var param string
+	if i >= 0 {
+		t.name = decl[:i]
+		closing := ")"
+		if decl[i] == '<' {
+			closing = ">"
+		}
+		if !strings.HasSuffix(decl, closing) {
+			return nil, errors.New("missing " + closing + " in type: " + decl)
+		}
+		param = strings.TrimSpace(decl[i+1 : len(decl)-1])
+		if param == "" {
+			return nil, errors.New("empty parameter for type: " + decl)
+		}
+		if (closing == ">") != (t.name == argTypeList) {
+			return nil, errors.New("invalid parameter for type: " + decl)
+		}
+	}
+
+	switch t.name {
+	case argTypeInt, argTypeBool, argTypeFloat, argTypeDuration, argTypeSecret:
+		if param != "" {
+			return nil, errors.New("type " + t.name + " has no constraints: " + decl)
+		}
+	case argTypeString:
+		if param != "" {
+			if err := t.parseStringConstraints(param); err != nil {
+				return nil, errors.New("invalid constraints for " + decl + ": " + err.Error())
+			}
+		}
+	case argTypeEnum:
+		if param == "" {
+			return nil, errors.New("missing values for Enum, e.g. Enum(dev|prod)")
+		}
+		seen := make(map[string]bool)
+		for _, v := range strings.Split(param, "|") {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[v] {
+				return nil, errors.New("empty or duplicate value in " + decl)
+			}
+			seen[v] = true
+			t.values = append(t.values, v)
+		}
+	case argTypeList:
+		if param == "" {
+			param = argTypeString
+		}
+		elem, err := parseArgType(param)
+		if err != nil {
+			return nil, err
+		}
+		if elem.name == argTypeList {
+			return nil, errors.New("nested lists are not supported: " + decl)
+		}
+		t.elem = elem
+	case argTypePath:
+		switch param {
+		case "", pathFile, pathDir:
+			t.pathKind = param
+		default:
+			return nil, errors.New("invalid constraint for " + decl + ", expected file or dir")
+		}
+	default:
+		return nil, errors.New("unknown type: " + decl)
+	}
+
+	return t, nil
+}
+
+// parse the constraints of a String: a length range like 3..20, a /regex/ or both separated by a comma
+func (t *argType) parseStringConstraints(param string) error {
+
+	if !strings.HasPrefix(param, "/") {
+		var lengths string
+		lengths, param = param, ""
+		if i := strings.Index(lengths, ","); i >= 0 {
+			lengths, param = lengths[:i], strings.TrimSpace(lengths[i+1:])
+		}
+
+		m := lengthRangeRegex.FindStringSubmatch(strings.TrimSpace(lengths))
+		if m == nil || m[1] == "" && m[2] == "" {
+			return errors.New("expected a length range like 3..20 or a /regex/")
+		}
+		if m[1] != "" {
+			t.minLen, _ = strconv.Atoi(m[1])
+		}
+		if m[2] != "" {
+			t.maxLen, _ = strconv.Atoi(m[2])
+		}
+		if t.maxLen >= 0 && t.minLen > t.maxLen {
+			return errors.New("minimum length is larger than the maximum")
+		}
+		if param == "" {
+			return nil
+		}
+	}
+
+	if len(param) < 2 || !strings.HasPrefix(param, "/") || !strings.HasSuffix(param, "/") {
+		return errors.New("expected a /regex/")
+	}
+
+	var err error
+	t.pattern, err = regexp.Compile(param[1 : len(param)-1])
+
+	return err
+}
+
+// the declaration, as shown in the command overview
+func (t *argType) String() string {
+	return t.decl
+}
+
+// check if a value matches the type and its constraints
+// the error states which constraint failed
+func (t *argType) validate(value string) error {
+
+	switch t.name {
+	case argTypeString:
+		// check if input is explicitly marked as string
+		// you could pass everything as a string, so otherwise lets check if its not something else...
+		if !isQuoted(value) {
+			if _, err := strconv.ParseBool(value); err == nil {
+				return errors.New("got bool but want string")
+			}
+			if _, err := strconv.ParseInt(value, 10, 0); err == nil {
+				return errors.New("got int but want string")
+			}
+			if _, err := strconv.ParseFloat(value, 10); err == nil {
+				return errors.New("got float but want string")
+			}
+		}
+		return t.validateString(unquote(value))
+	case argTypeSecret:
+		// any text, the value is masked in the output
+		return nil
+	case argTypeList:
+		for i, e := range splitList(value) {
+			if err := t.validateElem(e); err != nil {
+				return errors.New("element " + strconv.Itoa(i+1) + " (" + e + "): " + err.Error())
+			}
+		}
+		return nil
+	}
+
+	return t.validateScalar(value)
+}
+
+// check if a value is a valid element of a List
+func (t *argType) validateElem(value string) error {
+
+	// elements are always strings
+	if t.elem.name == argTypeString {
+		return t.elem.validateString(value)
+	}
+
+	return t.elem.validate(value)
+}
+
+// validate the constraints of a string
+func (t *argType) validateString(value string) error {
+
+	n := len([]rune(value))
+	if t.minLen >= 0 && n < t.minLen {
+		return errors.New("length " + strconv.Itoa(n) + " is below the minimum of " + strconv.Itoa(t.minLen))
+	}
+	if t.maxLen >= 0 && n > t.maxLen {
+		return errors.New("length " + strconv.Itoa(n) + " exceeds the maximum of " + strconv.Itoa(t.maxLen))
+	}
+	if t.pattern != nil && !t.pattern.MatchString(value) {
+		return errors.New("does not match the pattern /" + t.pattern.String() + "/")
+	}
+
+	return nil
+}
+
+// validate a value of a type other than String or List
+func (t *argType) validateScalar(value string) error {
+
+	var err error
+
+	switch t.name {
+	case argTypeBool:
+		_, err = strconv.ParseBool(value)
+	case argTypeInt:
+		_, err = strconv.ParseInt(value, 10, 0)
+	case argTypeFloat:
+		_, err = strconv.ParseFloat(value, 10)
+	case argTypeDuration:
+		_, err = time.ParseDuration(value)
+		if err != nil {
+			return errors.New("invalid duration, expected a value like 30s or 1h30m")
+		}
+	case argTypeEnum:
+		for _, v := range t.values {
+			if v == value {
+				return nil
+			}
+		}
+		return errors.New("must be one of: " + strings.Join(t.values, ", "))
+	case argTypePath:
+		info, err := os.Stat(expandHome(value))
+		if err != nil {
+			return errors.New("path does not exist")
+		}
+		if t.pathKind == pathDir && !info.IsDir() {
+			return errors.New("path is not a directory")
+		}
+		if t.pathKind == pathFile && info.IsDir() {
+			return errors.New("path is not a file")
+		}
+	default:
+		return errors.New("received unknown type")
+	}
+
+	return err
+}
+
+// zero value for optional arguments without a default value
+func (t *argType) zeroValue() string {
+	switch t.name {
+	case argTypeInt:
+		return "0"
+	case argTypeBool:
+		return "false"
+	case argTypeFloat:
+		return "0.0"
+	case argTypeDuration:
+		return "0s"
+	}
+	return ""
+}
+
+// literal of a value in the language of a command.
+// values are quoted and escaped, so they are used literally, lists are declared in the native form of the language
+func (t *argType) literal(syntax, value string) string {
+
+	// quotes mark a value as string, they are not part of it
+	value = unquote(value)
+
+	if t.name != argTypeList {
+		return scalarLiteral(syntax, t.literalType(), value)
+	}
+
+	return listLiteral(syntax, t.elem.literalType(), t.elements(value))
+}
+
+// type of the literals for values of the type
+func (t *argType) literalType() string {
+	switch t.name {
+	case argTypeInt:
+		return globalInt
+	case argTypeBool:
+		return globalBool
+	case argTypeFloat:
+		return globalFloat
+	}
+	return globalString
+}
+
+// typed value for JSON encoding, lists are arrays of their element type
+func (t *argType) typedValue(value string) interface{} {
+
+	value = unquote(value)
+
+	switch t.name {
+	case argTypeList:
+		list := make([]interface{}, 0)
+		for _, e := range t.elements(value) {
+			list = append(list, t.elem.typedValue(e))
+		}
+		return list
+	case argTypeInt:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case argTypeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case argTypeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// completions for the value of an argument, prefix is the value typed so far
+func (t *argType) complete(prefix string) (res []string) {
+
+	switch t.name {
+	case argTypeBool:
+		res = []string{"true", "false"}
+	case argTypeEnum:
+		res = t.values
+	case argTypePath:
+		dir, _ := filepath.Split(prefix)
+		files, err := os.ReadDir(expandHome(dir))
+		if err != nil {
+			return nil
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				res = append(res, dir+f.Name()+"/")
+			} else if t.pathKind != pathDir {
+				res = append(res, dir+f.Name())
+			}
+		}
+	case argTypeList:
+		// complete the last element of the list
+		i := strings.LastIndex(prefix, ",")
+		for _, e := range t.elem.complete(prefix[i+1:]) {
+			res = append(res, prefix[:i+1]+e)
+		}
+	}
+
+	return
+}
+
+// split the value of a List, elements are separated by commas
+func splitList(value string) []string {
+
+	if strings.TrimSpace(value) == "" {
+		return []string{}
+	}
+
+	list := strings.Split(value, ",")
+	for i, e := range list {
+		list[i] = strings.TrimSpace(e)
+	}
+
+	return list
+}
+
+// elements of a List value.
+// the values of variadic arguments are stored JSON encoded, so they can contain commas
+func (t *argType) elements(value string) []string {
+	if t.variadic {
+		return decodeList(value)
+	}
+	return splitList(value)
+}
+
+// encode the values of a variadic argument
+func encodeList(values []string) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// decode the values of a variadic argument,
+// values that are not JSON encoded are split like a List
+func decodeList(value string) []string {
+
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return splitList(value)
+	}
+	if list == nil {
+		return []string{}
+	}
+
+	return list
+}
+
+// check if a value is enclosed in single or double quotes
+func isQuoted(value string) bool {
+	return len(value) > 1 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'')
+}
+
+// remove the quotes around a value
+func unquote(value string) string {
+	if isQuoted(value) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -22,7 +22,6 @@ import (
 	"bytes"
 	"errors"
 	"os"
-	"reflect"
 	"strconv"
 	"strings"
 
@@ -36,10 +35,15 @@ var (
 
 // argument types
 const (
-	argTypeString = "String"
-	argTypeInt    = "Int"
-	argTypeBool   = "Bool"
-	argTypeFloat  = "Float"
+	argTypeString   = "String"
+	argTypeInt      = "Int"
+	argTypeBool     = "Bool"
+	argTypeFloat    = "Float"
+	argTypeEnum     = "Enum"
+	argTypeList     = "List"
+	argTypePath     = "Path"
+	argTypeDuration = "Duration"
+	argTypeSecret   = "Secret"
 )
 
 // a command argument has a name and a type and a value
@@ -48,8 +52,11 @@ type commandArg struct {
 	// argument label
 	name string
 
-	// argument type
-	argType reflect.Kind
+	// single letter for the short flag, e.g. f for -f
+	short string
+
+	// argument type and its constraints
+	argType *argType
 
 	// optionals are allowed, they can have default values
 	optional     bool
@@ -57,6 +64,9 @@ type commandArg struct {
 
 	// value after parsing argument input from commandline
 	value string
+
+	// values of a variadic argument after parsing, in the order they were passed
+	values []string
 }
 
 // validate arguments string from CommandsFile
@@ -79,8 +89,7 @@ func (c *CommandsFile) validateArgs(args []string) ([]*commandArg, error) {
 		}
 
 		var (
-			k            reflect.Kind
-			slice        = strings.Split(s, ":")
+			slice        = strings.SplitN(s, ":", 2)
 			opt          bool
 			defaultValue string
 		)
@@ -90,6 +99,20 @@ func (c *CommandsFile) validateArgs(args []string) ([]*commandArg, error) {
 			// argument name may contain leading whitespace - trim it
 			var argumentName = strings.TrimSpace(slice[0])
 
+			// a short flag can be declared after the name: force|f
+			var short string
+			if i := strings.Index(argumentName, "|"); i >= 0 {
+				argumentName, short = argumentName[:i], argumentName[i+1:]
+				if len(short) != 1 || !isLetter(short[0]) {
+					return nil, errors.New("invalid short flag for argument " + argumentName + ": " + short + ", expected a single letter")
+				}
+				for _, a := range validatedArgs {
+					if a.short == short {
+						return nil, errors.New("short flag -" + short + " was used twice")
+					}
+				}
+			}
+
 			// check for name conflicts with globals
 			g.Lock()
 			for name := range g.Vars {
@@ -107,40 +130,43 @@ func (c *CommandsFile) validateArgs(args []string) ([]*commandArg, error) {
 				return nil, ErrDuplicateArgumentNames
 			}
 
+			// the type ends after its constraints, which can contain ? and =
+			decl, rest := splitArgType(strings.TrimSpace(slice[1]))
+
+			// check if its an optional arg
+			if strings.HasPrefix(rest, "?") {
+				rest = strings.TrimSpace(strings.TrimPrefix(rest, "?"))
+				opt = true
+			}
+
 			// check if there's a default value set
-			defaultValSlice := strings.Split(slice[1], "=")
-			if len(defaultValSlice) > 1 {
-				if !strings.Contains(slice[1], "?") {
+			if strings.HasPrefix(rest, "=") {
+				if !opt {
 					return nil, errors.New("default values for mandatory arguments are not allowed: " + s + ", at index: " + strconv.Itoa(i))
 				}
-				slice[1] = strings.TrimSpace(defaultValSlice[0])
-				defaultValue = defaultValSlice[1]
+				defaultValue = strings.TrimPrefix(rest, "=")
+			} else if rest != "" {
+				return nil, errors.New("invalid argument declaration: " + s)
 			}
 
-			// check if its an optional arg
-			if strings.HasSuffix(slice[1], "?") {
-				slice[1] = strings.TrimSuffix(slice[1], "?")
-				opt = true
+			// check if its a valid argType
+			t, err := parseArgType(decl)
+			if err != nil {
+				return nil, errors.New("invalid or missing argument type: " + s + ": " + err.Error())
 			}
 
-			// check if its a valid argType and set reflect.Kind
-			switch slice[1] {
-			case argTypeBool:
-				k = reflect.Bool
-			case argTypeFloat:
-				k = reflect.Float64
-			case argTypeString:
-				k = reflect.String
-			case argTypeInt:
-				k = reflect.Int
-			default:
-				return nil, errors.New("invalid or missing argument type: " + s)
+			// validate default values, unless they are resolved later or refer to paths that might not exist yet
+			if v := strings.TrimSpace(defaultValue); v != "" && t.name != argTypePath && !strings.Contains(v, "${") {
+				if err := t.validate(v); err != nil {
+					return nil, errors.New("invalid default value for argument " + argumentName + ": " + err.Error())
+				}
 			}
 
 			// add to validatedArgs
 			validatedArgs = append(validatedArgs, &commandArg{
 				name:         argumentName,
-				argType:      k,
+				short:        short,
+				argType:      t,
 				optional:     opt,
 				defaultValue: defaultValue,
 			})
@@ -152,6 +178,146 @@ func (c *CommandsFile) validateArgs(args []string) ([]*commandArg, error) {
 	return validatedArgs, nil
 }
 
+// split the type declaration of an argument from the optional marker and default value that follow it
+// brackets of the constraints are matched, regular expressions between slashes are skipped
+func splitArgType(s string) (decl, rest string) {
+
+	var (
+		depth   int
+		inRegex bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '/' && depth > 0:
+			inRegex = !inRegex
+		case inRegex:
+		case c == '(' || c == '<':
+			depth++
+		case c == ')' || c == '>':
+			depth--
+		case depth == 0 && (c == '?' || c == '=' || c == ' '):
+			return s[:i], strings.TrimSpace(s[i:])
+		}
+	}
+
+	return s, ""
+}
+
+// normalize the arguments passed to a command into the label=value format.
+// values can be passed as label=value, --label=value, --label value, -s value or positional in declaration order,
+// --label and -s without a value set Bool arguments to true.
+// get the arguments after -- that are passed to the script
+// invalid arguments are reported when they are parsed
+func (c *command) passthroughArgs(rawArgs []string) []string {
+	_, passthrough, err := normalizeArgs(c.args, rawArgs)
+	if err != nil {
+		return nil
+	}
+	return passthrough
+}
+
+// everything after -- is returned as passthrough arguments for the script
+func normalizeArgs(declared []*commandArg, args []string) (labeled, passthrough []string, err error) {
+
+	var (
+		positional []string
+		set        = make(map[string]bool)
+	)
+
+	for i := 0; i < len(args); i++ {
+
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			passthrough = append(passthrough, args[i+1:]...)
+			i = len(args)
+
+		case isFlag(arg):
+			cmdArg, value, hasValue := lookupFlag(declared, arg)
+			if cmdArg == nil {
+				return nil, nil, errors.New(ErrInvalidArgumentLabel.Error() + ": " + ansi.Red + strings.SplitN(arg, "=", 2)[0] + cp.Reset)
+			}
+			if !hasValue {
+				if cmdArg.argType.name == argTypeBool {
+					value = "true"
+				} else if i+1 < len(args) {
+					i++
+					value = args[i]
+				} else {
+					return nil, nil, errors.New("missing value for " + arg)
+				}
+			}
+			labeled = append(labeled, cmdArg.name+"="+value)
+			set[cmdArg.name] = true
+
+		case strings.Contains(arg, "=") && globalNameRegex.MatchString(strings.SplitN(arg, "=", 2)[0]):
+			labeled = append(labeled, arg)
+			set[strings.SplitN(arg, "=", 2)[0]] = true
+
+		default:
+			// values that contain a = but no valid label, like URLs, are positional too
+			positional = append(positional, arg)
+		}
+	}
+
+	// assign positional values to the arguments that have not been set, in declaration order.
+	// a variadic argument takes all remaining values
+	for _, a := range declared {
+		if len(positional) == 0 {
+			break
+		}
+		if a.argType.variadic {
+			for _, v := range positional {
+				labeled = append(labeled, a.name+"="+v)
+			}
+			positional = nil
+		} else if !set[a.name] {
+			labeled = append(labeled, a.name+"="+positional[0])
+			positional = positional[1:]
+		}
+	}
+	if len(positional) > 0 {
+		return nil, nil, errors.New("too many arguments: " + strings.Join(positional, " "))
+	}
+
+	return labeled, passthrough, nil
+}
+
+// check if an argument is a --label or -s flag, negative numbers are values
+func isFlag(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err != nil
+}
+
+// find the declared argument for a --label or -s flag, the value can be attached with =
+func lookupFlag(declared []*commandArg, flag string) (arg *commandArg, value string, hasValue bool) {
+
+	name := flag
+	if i := strings.Index(flag, "="); i >= 0 {
+		name, value, hasValue = flag[:i], flag[i+1:], true
+	}
+
+	for _, a := range declared {
+		if name == "--"+a.name || a.short != "" && name == "-"+a.short {
+			return a, value, hasValue
+		}
+	}
+
+	return nil, "", false
+}
+
+// check if a character is an ASCII letter
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
 // parse arguments array in the label=value format
 // and return a code snippet that declares them in the language of the command
 func (c *command) parseArguments(args []string) (string, map[string]string, error) {
@@ -168,6 +334,20 @@ func (c *command) parseArguments(args []string) (string, map[string]string, erro
 		argValues = map[string]string{}
 	)
 
+	// flush arg values before returning, also when the arguments are invalid
+	defer func() {
+		for _, arg := range c.args {
+			arg.value = ""
+			arg.values = nil
+		}
+	}()
+
+	// positional arguments and flags are converted to the label=value format
+	args, _, err := normalizeArgs(c.args, args)
+	if err != nil {
+		return "", argValues, err
+	}
+
 	// parse args
 	for _, val := range args {
 
@@ -195,17 +375,34 @@ func (c *command) parseArguments(args []string) (string, map[string]string, erro
 				occurrences[argSlice[0]] = 1
 			}
 
-			if occurrences[argSlice[0]] > 1 {
+			// variadic arguments collect repeated labels
+			if occurrences[argSlice[0]] > 1 && !cmdArg.argType.variadic {
 				return "", argValues, errors.New("argument label appeared more than once: " + cmdArg.name)
 			}
 
-			argValue := argSlice[1]
-			if err := validArgType(argValue, cmdArg.argType); err != nil {
+			argValue, err := resolveSecrets(argSlice[1])
+			if err != nil {
+				return "", argValues, err
+			}
+
+			// every value of a variadic argument is a single element, it can contain commas
+			validate := cmdArg.argType.validate
+			if cmdArg.argType.variadic {
+				validate = cmdArg.argType.validateElem
+			}
+			if err := validate(argValue); err != nil {
 				return "", argValues, errors.New(ErrInvalidArgumentType.Error() + ": " + err.Error() + ", label=" + cmdArg.name + ", value=" + argValue)
 			}
+			if cmdArg.argType.name == argTypeSecret {
+				addSecretValue(argValue)
+			}
 
 			// temporarily set value on arg
-			cmdArg.value = argValue
+			if cmdArg.argType.variadic {
+				cmdArg.values = append(cmdArg.values, argValue)
+			} else {
+				cmdArg.value = argValue
+			}
 		} else {
 			return "", argValues, errors.New("invalid argument: " + val)
 		}
@@ -215,41 +412,53 @@ func (c *command) parseArguments(args []string) (string, map[string]string, erro
 	if err != nil {
 		return "", argValues, err
 	}
+	syntax := lang.literalSyntax()
 
 	for _, arg := range c.args {
+
+		// variadic values are stored encoded in the argument values, so they can be split again
+		if len(arg.values) > 0 {
+			arg.value = encodeList(arg.values)
+		}
+
 		if arg.value == "" {
 			if arg.optional {
 				if arg.defaultValue != "" {
 
-					argValues[arg.name] = arg.defaultValue
+					defaultValue, err := resolveSecrets(resolveEnvironment(strings.TrimSpace(arg.defaultValue)))
+					if err != nil {
+						return "", argValues, err
+					}
+					if arg.argType.name == argTypeSecret {
+						addSecretValue(defaultValue)
+					}
+					if arg.argType.variadic {
+						defaultValue = encodeList(splitList(defaultValue))
+					}
+					argValues[arg.name] = defaultValue
 
 					// default value has been set
-					argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + strings.TrimSpace(arg.defaultValue) + lang.LineDelimiter + "\n")
+					argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + arg.argType.literal(syntax, defaultValue) + lang.LineDelimiter + "\n")
 				} else {
 
-					argValues[arg.name] = getDefaultValue(arg)
+					argValues[arg.name] = arg.argType.zeroValue()
 
 					// init empty optionals with default value for their type
-					argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + getDefaultValue(arg) + lang.LineDelimiter + "\n")
+					argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + arg.argType.literal(syntax, arg.argType.zeroValue()) + lang.LineDelimiter + "\n")
 				}
 			} else {
 				// empty value and not optional - error
-				return "", argValues, errors.New(c.name + " is missing an argument: " + ansi.Red + arg.name + ":" + strings.Title(arg.argType.String()) + cp.Reset)
+				return "", argValues, errors.New(c.name + " is missing an argument: " + ansi.Red + arg.name + ":" + arg.argType.String() + cp.Reset)
 			}
 		} else {
 
 			argValues[arg.name] = arg.value
 
 			// write value into buffer
-			argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + arg.value + lang.LineDelimiter + "\n")
+			argBuf.WriteString(lang.VariableKeyword + arg.name + lang.AssignmentOperator + arg.argType.literal(syntax, arg.value) + lang.LineDelimiter + "\n")
 		}
 	}
 
-	// flush arg values before returning
-	for _, arg := range c.args {
-		arg.value = ""
-	}
-
 	return argBuf.String(), argValues, nil
 }
 
@@ -299,7 +508,70 @@ func replaceArgs(input string, args map[string]string) (string, error) {
 	return input, nil
 }
 
-func (c *CommandsFile) replaceGlobals(input string) string {
+// replace the arguments in ${} notation, variadic arguments are expanded once per value:
+// build/${pkg}.a with pkg=a,b results in build/a.a and build/b.a.
+// if several variadic arguments are used, all combinations are returned
+func (c *command) expandArgs(input string, argValues map[string]string) ([]string, error) {
+
+	results := []string{input}
+	for _, a := range c.args {
+		if !a.argType.variadic || !strings.Contains(input, "${"+a.name+"}") {
+			continue
+		}
+		var expanded []string
+		for _, r := range results {
+			for _, v := range decodeList(argValues[a.name]) {
+				expanded = append(expanded, strings.ReplaceAll(r, "${"+a.name+"}", v))
+			}
+		}
+		results = expanded
+	}
+
+	values := c.joinArgs(argValues)
+	for i, r := range results {
+		out, err := replaceArgs(r, values)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = out
+	}
+
+	return results, nil
+}
+
+// the argument values as text, the values of variadic arguments are joined by commas
+func (c *command) joinArgs(argValues map[string]string) map[string]string {
+
+	joined := make(map[string]string, len(argValues))
+	for name, v := range argValues {
+		joined[name] = v
+	}
+	for _, a := range c.args {
+		if _, ok := argValues[a.name]; ok && a.argType.variadic {
+			joined[a.name] = strings.Join(decodeList(argValues[a.name]), ",")
+		}
+	}
+
+	return joined
+}
+
+// expand the arguments in a list of outputs or inputs
+func (c *command) expandAll(list []string, argValues map[string]string) ([]string, error) {
+
+	var res []string
+	for _, item := range list {
+		expanded, err := c.expandArgs(item, argValues)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, expanded...)
+	}
+
+	return res, nil
+}
+
+// replace globals used in ${} notation, computed globals are evaluated if needed
+func (c *CommandsFile) replaceGlobals(input string) (string, error) {
 	var (
 		dollar, startOfIdent bool
 		name                 string
@@ -335,12 +607,16 @@ func (c *CommandsFile) replaceGlobals(input string) string {
 	}
 
 	for _, n := range names {
-		if val, ok := g.Vars[n]; ok {
+		val, ok, err := g.get(n)
+		if err != nil {
+			return "", err
+		}
+		if ok {
 			input = strings.ReplaceAll(input, "${"+n+"}", val)
 		}
 	}
 
-	return input
+	return input, nil
 }
 
 func resolveEnvironment(input string) string {
@@ -379,6 +655,10 @@ func resolveEnvironment(input string) string {
 	}
 
 	for _, n := range names {
+		// secrets are resolved separately
+		if strings.HasPrefix(n, secretPrefix) {
+			continue
+		}
 		input = strings.ReplaceAll(input, "${"+n+"}", os.Getenv(n))
 	}
 
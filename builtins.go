@@ -20,7 +20,6 @@ package main
 
 import (
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"sort"
@@ -61,6 +60,10 @@ const (
 	procsCommand      = "procs"
 	editCommand       = "edit"
 	generateCommand   = "generate"
+	graphCommand      = "graph"
+	explainCommand    = "explain"
+	reportCommand     = "report"
+	secretsCommand    = "secrets"
 )
 
 // mapped builtin names to description
@@ -68,7 +71,7 @@ var builtins = map[string]string{
 	exitCommand:       "leave the interactive shell",
 	helpCommand:       "print the command overview or the manualtext for a specific command",
 	clearCommand:      "clear the terminal screen",
-	infoCommand:       "print project info (lines of code + latest git commits)",
+	infoCommand:       "print project info (lines of code + latest git commits + resource usage)",
 	formatCommand:     "run the formatter for all scripts",
 	globalsCommand:    "print the current globals",
 	configCommand:     "print or change the current config",
@@ -92,6 +95,10 @@ var builtins = map[string]string{
 	procsCommand:      "manage spawned processes",
 	editCommand:       "edit scripts",
 	generateCommand:   "generate a standalone version of the script",
+	graphCommand:      "print the dependency graph of a command or commandChain",
+	explainCommand:    "print the execution plan of a command or commandChain without executing it",
+	reportCommand:     "print a report of the recorded runs",
+	secretsCommand:    "list the secrets or store values in the encrypted secrets file",
 }
 
 // executed when running the info command
@@ -105,7 +112,6 @@ func printProjectInfo() {
 	err := cmd.Run()
 	if err != nil {
 		Log.WithError(err).Info("running cloc failed.")
-		return
 	}
 
 	cmd = exec.Command("git", "log", "-n", "5")
@@ -115,8 +121,9 @@ func printProjectInfo() {
 	err = cmd.Run()
 	if err != nil {
 		Log.WithError(err).Info("running git log failed.")
-		return
 	}
+
+	printResourceUsage()
 }
 
 // print built-in commands
@@ -207,15 +214,19 @@ func printSortedCommandKeys(sortedCommandKeys []string) {
 			}
 
 			if cmd.path != "" {
-				printLine(pad("path", maxLen)+cp.CmdFields+cmd.path, lastElem, !(len(cmd.dependencies) > 0) && !(len(cmd.outputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
+				printLine(pad("path", maxLen)+cp.CmdFields+cmd.path, lastElem, !(len(cmd.dependencies) > 0) && !(len(cmd.outputs) > 0) && !(len(cmd.inputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
 			}
 
 			if len(cmd.dependencies) > 0 {
-				printLine(pad("dependencies", maxLen)+cp.CmdFields+formatDependencies(cmd.dependencies), lastElem, !(len(cmd.outputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
+				printLine(pad("dependencies", maxLen)+cp.CmdFields+formatDependencies(cmd.dependencies), lastElem, !(len(cmd.outputs) > 0) && !(len(cmd.inputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
 			}
 
 			if len(cmd.outputs) > 0 {
-				printLine(pad("outputs", maxLen)+cp.CmdFields+strings.Join(cmd.outputs, ", "), lastElem, !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
+				printLine(pad("outputs", maxLen)+cp.CmdFields+strings.Join(cmd.outputs, ", "), lastElem, !(len(cmd.inputs) > 0) && !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
+			}
+
+			if len(cmd.inputs) > 0 {
+				printLine(pad("inputs", maxLen)+cp.CmdFields+strings.Join(cmd.inputs, ", "), lastElem, !cmd.async && !cmd.buildNumber && !(len(cmd.description) > 0))
 			}
 
 			if cmd.async {
@@ -252,33 +263,17 @@ func printLine(line string, lastElem, lastItem bool) {
 }
 
 // format commandArg map into human readable string
+// the args are listed in declaration order, which is the order of positional values
 func getArgumentString(args []*commandArg) string {
 
 	if len(args) == 0 {
 		return ""
 	}
 
-	var (
-		requiredArgs string
-		optionalArgs string
-		count        = 1
-		names        []string
-	)
+	var formatted []string
+	for _, arg := range args {
 
-	// sort args alphabetically before printing, so the order does not change in between multiple runs.
-	for _, a := range args {
-		names = append(names, a.name)
-	}
-	sort.Strings(names)
-
-	for _, name := range names {
-
-		arg, ok := containsArg(args, name)
-		if !ok {
-			log.Fatal("could not find arg: " + name)
-		}
-
-		var t = cp.CmdArgType + strings.Title(arg.argType.String())
+		var t = cp.CmdArgType + arg.argType.String()
 		if arg.optional {
 			if arg.defaultValue != "" {
 				t += "?" + cp.CmdOutput + " =" + arg.defaultValue
@@ -286,18 +281,42 @@ func getArgumentString(args []*commandArg) string {
 				t += "?"
 			}
 		}
-		if arg.optional {
-			optionalArgs += cp.CmdArgs + arg.name + cp.Text + ":" + t + cp.Text + ", "
-		} else {
-			requiredArgs += cp.CmdArgs + arg.name + cp.Text + ":" + t + cp.Text + ", "
+
+		name := cp.CmdArgs + arg.name
+		if arg.short != "" {
+			name += cp.Text + "|" + cp.CmdArgs + arg.short
 		}
-		count++
+		formatted = append(formatted, name+cp.Text+":"+t+cp.Text)
 	}
 
-	if optionalArgs == "" {
-		return cp.Text + "(" + strings.TrimSuffix(requiredArgs, ", ") + cp.Text + ")"
+	return cp.Text + "(" + strings.Join(formatted, ", ") + cp.Text + ")"
+}
+
+// usage of a command with positional values and flags
+// e.g. deploy <env> [tag] [--force|-f] [-- args...]
+func argUsage(name string, args []*commandArg) string {
+
+	usage := name
+	for _, arg := range args {
+		name := arg.name
+		if arg.argType.variadic {
+			name += variadicSuffix
+		}
+		switch {
+		case arg.argType.name == argTypeBool && arg.optional:
+			flag := "--" + arg.name
+			if arg.short != "" {
+				flag += "|-" + arg.short
+			}
+			usage += " [" + flag + "]"
+		case arg.optional:
+			usage += " [" + name + "]"
+		default:
+			usage += " <" + name + ">"
+		}
 	}
-	return cp.Text + "(" + requiredArgs + strings.TrimSuffix(optionalArgs, ", ") + cp.Text + ")"
+
+	return usage + " [-- args...]"
 }
 
 func printGitFilterCommandUsageErr() {
@@ -27,9 +27,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dreadl0ck/readline"
@@ -93,9 +94,13 @@ type command struct {
 	dependencies []string
 
 	// output file(s) of the command
-	// if the file exists the command will not be executed
+	// if the files exist and nothing changed since the last successful run the command will not be executed
 	outputs []string
 
+	// input file globs of the command
+	// changes to their contents cause the command to be executed again
+	inputs []string
+
 	// if the command has been generated by a CommandsFile
 	// the script that will be executed goes in here
 	exec string
@@ -110,6 +115,44 @@ type command struct {
 	// sets the base configuration to use for this command
 	extends string
 
+	// absolute path of the commandsFile that declared the command
+	source string
+
+	// maximum duration of a single execution
+	// the process group of the command is killed once it is exceeded
+	timeout time.Duration
+
+	// number of times the command is executed again after a failure
+	retries int
+
+	// time to wait between the attempts
+	retryDelay time.Duration
+
+	// restart policy for detached commands: always or on-failure
+	restart string
+
+	// maximum number of restarts, zero means unlimited
+	maxRestarts int
+
+	// initial delay before a restart
+	restartDelay time.Duration
+
+	// health check for detached commands
+	healthCheck *healthCheck
+
+	// resource limits applied to the interpreter
+	limits *resourceLimits
+
+	// filesystem and network restrictions
+	sandbox *sandbox
+
+	// environment policy of the command and of its commandsFile
+	env        *envData
+	projectEnv *envData
+
+	// how arguments are passed, overwrites the argMode of the language
+	argMode string
+
 	// controls whether execution stops if this command encounters an error
 	// if nil, uses the global StopOnError config
 	stopOnError *bool
@@ -129,6 +172,7 @@ func (c *command) AsyncRun(args []string) error {
 }
 
 // Run executes the command
+// dependencies are resolved into a graph and executed prior to the command itself
 func (c *command) Run(args []string, async bool) error {
 
 	// spawn async commands in a new goroutine
@@ -136,168 +180,325 @@ func (c *command) Run(args []string, async bool) error {
 		return c.AsyncRun(args)
 	}
 
-	// handle args
-	argBuffer, argValues, err := c.parseArguments(args)
-	if err != nil {
-		return err
-	}
+	return c.run(args, nil)
+}
+
+// execute the command and its dependencies
+// missing arguments of all invocations are read with read, if it is not nil
+func (c *command) run(args []string, read promptReader) error {
+
+	dg := newDepGraph()
+	dg.read = read
 
-	// handle dependencies
-	err = c.execDependencies(argValues)
+	_, err := dg.addRoot(c, args)
 	if err != nil {
-		return errors.New("dependency error: " + err.Error())
+		return err
 	}
 
-	return c.AtomicRun(argBuffer, argValues, args, false)
+	return dg.exec()
 }
 
-func (c *command) AtomicRun(argBuffer string, argValues map[string]string, rawArgs []string, async bool) error {
+// execute a single command invocation without resolving its dependencies
+// the result of the execution is stored in the record, if one is supplied
+func (c *command) AtomicRun(argBuffer string, argValues map[string]string, rawArgs []string, async bool, record *commandRecord) error {
 
 	// spawn async commands in a new goroutine
 	if async {
 		return c.AsyncRun(rawArgs)
 	}
 
-	var (
-		cLog         = Log.WithField("prefix", c.name)
-		start        = time.Now()
-		stdErrBuffer = &bytes.Buffer{}
-	)
+	cLog := Log.WithField("prefix", c.name)
 
-	// check outputs
-	if len(c.outputs) > 0 {
+	// evaluate computed globals whose ttl expired, before they are used for the hash
+	err := g.refresh()
+	if err != nil {
+		return err
+	}
 
-		var outputMissing bool
+	// check if the command needs to be executed
+	passthrough := c.passthroughArgs(rawArgs)
+	upToDate, hash, reason, err := c.upToDate(argValues, passthrough)
+	if err != nil {
+		return err
+	}
+	if upToDate {
+		// all outputs exist and nothing changed since the last successful run, skip command
+		s.Lock()
+		s.currentCommand++
+		index, total := s.currentCommand, s.numCommands
+		s.Unlock()
 
-		// check if all named outputs exist
-		for _, output := range c.outputs {
+		emitEvent(&executionEvent{
+			Type:    eventSkip,
+			Command: c.name,
+			Args:    argValues,
+			Step:    index,
+			Total:   total,
+			Reason:  "all named outputs are up to date",
+			record:  record,
+		})
+		if !jsonLogFormat() {
+			l.Println(printPrompt() + "[" + strconv.Itoa(index) + "/" + strconv.Itoa(total) + "] skipping " + cp.Prompt + c.name + cp.Reset + " because all named outputs are up to date")
+		}
+		return nil
+	}
+	if len(c.outputs) > 0 {
+		Log.Debug("[" + ansi.Red + c.name + cp.Reset + "] not up to date: " + reason)
+	}
 
-			out, err := replaceArgs(output, argValues)
-			if err != nil {
-				return err
-			}
+	// handle args in workingDir
+	// the directory is set on the exec.Cmd instead of changing the directory of the zeus process,
+	// because multiple commands might be executing in parallel
+	workDir, err := replaceArgs(c.workingDir, c.joinArgs(argValues))
+	if err != nil {
+		return err
+	}
 
-			Log.Debug("checking output ", out)
+	cLog.WithFields(logrus.Fields{
+		"prefix": "exec",
+		"args":   rawArgs,
+	}).Debug(cp.CmdName + c.name + cp.Reset)
 
-			_, err = os.Stat(out)
-			if err != nil {
-				Log.Debug("["+ansi.Red+c.name+cp.Reset+"] output missing: ", output)
-				outputMissing = true
-			}
-		}
+	// remember the position of the command for the progress output
+	// the counter is shared between commands executing in parallel
+	s.Lock()
+	s.currentCommand++
+	index := s.currentCommand
+	s.Unlock()
 
-		if !outputMissing {
-			// all output files / dirs exist, skip command
-			s.Lock()
-			s.currentCommand++
-			l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] skipping " + cp.Prompt + c.name + cp.Reset + " because all named outputs exist")
-			s.Unlock()
-			return nil
-		}
+	// increase build number if set
+	if c.buildNumber {
+		projectData.Lock()
+		projectData.fields.BuildNumber++
+		projectData.Unlock()
+		projectData.update()
 	}
 
-	if c.workingDir != "" {
+	// detached commands are started only once
+	attempts := c.retries + 1
+	if c.async {
+		attempts = 1
+	}
 
-		// handle args in workingDir
-		finalWorkDir, err := replaceArgs(c.workingDir, argValues)
-		if err != nil {
+	for attempt := 1; ; attempt++ {
+
+		err = c.execute(argValues, argBuffer, rawArgs, workDir, index, attempt, attempts, record)
+		if err == nil {
+			break
+		}
+
+		// don't retry if the user interrupted the execution
+		if attempt == attempts || err.Error() == "signal: interrupt" {
 			return err
 		}
 
-		Log.Debug("moving into workingDir: ", finalWorkDir)
+		if !jsonLogFormat() {
+			s.Lock()
+			l.Println(printPrompt() + "[" + strconv.Itoa(index) + "/" + strconv.Itoa(s.numCommands) + "] attempt " + strconv.Itoa(attempt) + "/" + strconv.Itoa(attempts) + " of " + cp.Prompt + c.name + cp.Reset + " failed: " + err.Error() + ", retrying in " + c.retryDelay.String())
+			s.Unlock()
+		}
+		time.Sleep(c.retryDelay)
+	}
 
-		err = os.Chdir(finalWorkDir)
-		if err != nil {
-			return err
+	// remember the state that produced the outputs
+	if hash != "" && !c.async {
+		if err := recordHash(c.name, argValues, passthrough, hash); err != nil {
+			cLog.WithError(err).Error("failed to store hash")
 		}
 	}
 
-	cLog.WithFields(logrus.Fields{
-		"prefix": "exec",
-		"args":   rawArgs,
-	}).Debug(cp.CmdName + c.name + cp.Reset)
+	return nil
+}
 
-	s.Lock()
-	s.currentCommand++
-	s.Unlock()
+// execute a single attempt of the command
+func (c *command) execute(argValues map[string]string, argBuffer string, rawArgs []string, workDir string, index, attempt, attempts int, record *commandRecord) error {
+
+	var (
+		cLog         = Log.WithField("prefix", c.name)
+		start        = time.Now()
+		stdErrBuffer = &bytes.Buffer{}
+	)
 
 	// init command
-	cmd, script, cleanupFunc, err := c.createCommand(argValues, argBuffer, rawArgs)
+	cmd, script, cleanupFunc, err := c.createCommand(argValues, argBuffer, rawArgs, workDir)
 	if err != nil {
 		return err
 	}
 
-	// TODO: make injecting the globals via env with a prefix configurable
-	//prefix := "zeus_"
-	prefix := ""
-
-	// set host shell environment
-	cmd.Env = os.Environ()
-	for name, value := range g.Vars {
-		cmd.Env = append(cmd.Env, prefix+name+"="+value)
+	// set the environment according to the policy, including the globals
+	// the variables for the arguments are set by createCommand and added last
+	vars, _ := g.snapshot()
+	env, err := c.environment().environ(vars)
+	if err != nil {
+		if cleanupFunc != nil {
+			cleanupFunc()
+		}
+		return err
 	}
+	cmd.Env = append(env[:len(env):len(env)], cmd.Env...)
+
+	var (
+		id     = processID(randomString())
+		output *outputBuffer
+	)
 
 	// don't wire terminalIO for async jobs
-	// they can be attached by using the procs builtin
-	if !c.async {
+	// their output is captured and can be attached by using the procs builtin
+	if c.async {
+		output, err = newOutputBuffer(processLogPath(c.name, id))
+		if err != nil {
+			if cleanupFunc != nil {
+				cleanupFunc()
+			}
+			return errors.New("failed to create process log: " + err.Error())
+		}
+		cmd.Stdout = output
+		cmd.Stderr = output
+	} else {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = io.MultiWriter(os.Stderr, stdErrBuffer)
-		cmd.Stdin = os.Stdin
-	}
-
-	// increase build number if set
-	if c.buildNumber {
-		projectData.Lock()
-		projectData.fields.BuildNumber++
-		projectData.Unlock()
-		projectData.update()
+		if canOwnTerminal(c.async) {
+			cmd.Stdin = os.Stdin
+		}
 	}
 
-	s.Lock()
-	if c.async {
-		l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] detaching " + cp.Prompt + c.name + cp.Reset)
-	} else {
-		l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] executing " + cp.Prompt + c.name + cp.Reset)
+	if !jsonLogFormat() {
+		var attemptInfo string
+		if attempt > 1 {
+			attemptInfo = cp.Text + " (attempt " + strconv.Itoa(attempt) + "/" + strconv.Itoa(attempts) + ")" + cp.Reset
+		}
+		s.Lock()
+		if c.async {
+			l.Println(printPrompt() + "[" + strconv.Itoa(index) + "/" + strconv.Itoa(s.numCommands) + "] detaching " + cp.Prompt + c.name + cp.Text + " (ID: " + string(id) + ")" + cp.Reset)
+		} else {
+			l.Println(printPrompt() + "[" + strconv.Itoa(index) + "/" + strconv.Itoa(s.numCommands) + "] executing " + cp.Prompt + c.name + cp.Reset + attemptInfo)
+		}
+		s.Unlock()
 	}
-	s.Unlock()
 
 	// lets go
-	err = cmd.Start()
+	// every command runs in its own process group
+	// so the interpreter and all its children can be signaled together
+	releaseTerminal, err := startProcessGroup(cmd, canOwnTerminal(c.async))
 	if err != nil {
 		cLog.WithError(err).Fatal("failed to start command: " + c.name)
 	}
+	defer releaseTerminal()
 
 	// add to processMap
-	var (
-		id  = processID(randomString())
-		pid = cmd.Process.Pid
-	)
+	pid := cmd.Process.Pid
 	cLog.Debug("PID: ", pid)
-	addProcess(id, c.name, cmd.Process, pid)
+
+	var p *Process
+	if c.async {
+		p = addDetachedProcess(id, c.name, cmd.Process, output)
+	} else {
+		addProcess(id, c.name, cmd.Process, pid)
+	}
+
+	s.Lock()
+	total := s.numCommands
+	s.Unlock()
+
+	// the event is reused for the result of the execution
+	ev := &executionEvent{
+		Type:    eventStart,
+		Command: c.name,
+		Args:    argValues,
+		Step:    index,
+		Total:   total,
+		PID:     pid,
+		Async:   c.async,
+		record:  record,
+	}
+	if attempts > 1 {
+		ev.Attempt = attempt
+		ev.Attempts = attempts
+	}
+	emitEvent(ev)
+
+	// detached processes are supervised in the background
+	// and stay in the processMap after they exited, to expose their exit status
+	if c.async {
+
+		// restarts create a new instance of the command that writes to the same output
+		respawn := func() (*exec.Cmd, func(), error) {
+			cmd, _, cleanupFunc, err := c.createCommand(argValues, argBuffer, rawArgs, workDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			cmd.Env = append(env[:len(env):len(env)], cmd.Env...)
+			cmd.Stdout = output
+			cmd.Stderr = output
+
+			_, err = startProcessGroup(cmd, false)
+			if err != nil {
+				if cleanupFunc != nil {
+					cleanupFunc()
+				}
+				return nil, nil, err
+			}
+			return cmd, cleanupFunc, nil
+		}
+
+		if c.healthCheck != nil {
+			processMapMutex.Lock()
+			p.Health = healthStarting
+			processMapMutex.Unlock()
+			go c.monitorHealth(p, workDir)
+		}
+
+		go c.supervise(cmd, p, *ev, cleanupFunc, start, respawn)
+		return nil
+	}
 
 	// after command has finished running, remove from processMap
 	defer deleteProcessByPID(pid)
 
 	// wait for process
-	return c.waitForProcess(cmd, cleanupFunc, script, id, pid, start, stdErrBuffer)
+	return c.waitForProcess(cmd, cleanupFunc, script, ev, start, stdErrBuffer)
 }
 
-func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script string, id processID, pid int, start time.Time, stdErrBuffer *bytes.Buffer) error {
+func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script string, ev *executionEvent, start time.Time, stdErrBuffer *bytes.Buffer) error {
 
 	cLog := Log.WithField("prefix", "waitForProcess")
 
+	// kill the process group once the timeout is exceeded
+	var timedOut int32
+	if c.timeout > 0 {
+		pid := cmd.Process.Pid
+		timer := time.AfterFunc(c.timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			cLog.Debug("timeout exceeded, killing process group ", pid)
+			syscall.Kill(-pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
 	// wait for command to finish execution
 	err := cmd.Wait()
+	ev.Resources = resourceUsageOf(cmd.ProcessState)
+	if err != nil && atomic.LoadInt32(&timedOut) == 1 {
+		err = errors.New("timeout after " + c.timeout.String())
+	}
 	if err != nil {
 
+		ev.Type = eventFail
+		ev.Time = time.Now()
+		ev.DurationMS = durationMS(time.Since(start))
+		ev.ExitCode = exitCode(err)
+		ev.Error = err.Error()
+		ev.Stderr = tail(stdErrBuffer.String(), stderrTailLines)
+		emitEvent(ev)
+
 		// execute cleanupFunc if there is one
 		if cleanupFunc != nil {
 			cleanupFunc()
 		}
 
 		// dump the script with line numbers for troubleshooting
-		// if the error is not an interrupt signal
-		if err.Error() != "signal: interrupt" {
+		// if the error is not an interrupt signal or a timeout
+		if err.Error() != "signal: interrupt" && atomic.LoadInt32(&timedOut) == 0 {
 
 			// when there are no globals
 			// read the command script directly
@@ -330,7 +531,10 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 			}
 
 			// dump complete script and highlight error
-			printScript(script, c.name, i)
+			// not in JSON log format, the stderr output is part of the fail event instead
+			if !jsonLogFormat() {
+				printScript(script, c.name, i)
+			}
 			if conf.fields.DumpScriptOnError {
 				dumpScript(script, c.language, err, stdErrBuffer.String())
 			}
@@ -343,298 +547,298 @@ func (c *command) waitForProcess(cmd *exec.Cmd, cleanupFunc func(), script strin
 		modifyPrompt()
 	}
 
-	if c.async {
-
-		// add to process map PID +1
-		cLog.Debug("detached PID: ", pid+1)
-		addProcess(id, c.name, nil, pid+1)
-
-		func() {
-			for {
+	code := 0
+	ev.Type = eventFinish
+	ev.Time = time.Now()
+	ev.DurationMS = durationMS(time.Since(start))
+	ev.ExitCode = &code
+	emitEvent(ev)
 
-				// check if detached process is still alive
-				// If sig is 0, then no signal is sent, but error checking is still performed
-				// this can be used to check for the existence of a process ID or process group ID
-				err := exec.Command("kill", "-0", strconv.Itoa(pid+1)).Run()
-				if err != nil {
-					Log.Debug("detached process with PID " + strconv.Itoa(pid+1) + " exited")
-					deleteProcessByPID(pid + 1)
-
-					// execute cleanupFunc if there is one
-					if cleanupFunc != nil {
-						cleanupFunc()
-					}
-					return
-				}
-
-				time.Sleep(2 * time.Second)
-			}
-		}()
-	} else {
+	if !jsonLogFormat() {
 		s.Lock()
 		// print stats
 		l.Println(
-			printPrompt()+"["+strconv.Itoa(s.currentCommand)+"/"+strconv.Itoa(s.numCommands)+"] finished "+cp.Prompt+c.name+cp.Text+" in"+cp.Prompt,
+			printPrompt()+"["+strconv.Itoa(ev.Step)+"/"+strconv.Itoa(s.numCommands)+"] finished "+cp.Prompt+c.name+cp.Text+" in"+cp.Prompt,
 			time.Now().Sub(start),
-			cp.Reset,
+			resourceSummary(ev.Resources)+cp.Reset,
 		)
 		s.Unlock()
+	}
 
-		// execute cleanupFunc if there is one
-		if cleanupFunc != nil {
-			cleanupFunc()
-		}
+	// execute cleanupFunc if there is one
+	if cleanupFunc != nil {
+		cleanupFunc()
 	}
 
 	return nil
 }
 
-// collect dependencies for the current command
-// iterating recursively on all the sub-dependencies
-func (c *command) getDeepDependencies(argValues map[string]string) (deps []string, err error) {
-
-	for _, dep := range c.dependencies {
-
-		// get fields
-		depFields := strings.Fields(dep)
-		if len(depFields) == 0 {
-			continue
-		}
-
-		// lookup dep command
-		depCmd, err := cmdMap.getCommand(depFields[0])
-		if err == nil {
-
-			Log.Debug("getDeepDependencies: ", depCmd.name, " parseArguments: ", depFields[1:])
-
-			// parse args for command
-			_, args, err := depCmd.parseArguments(depFields[1:])
-			if err != nil {
-				return nil, err
-			}
-
-			// get it's dependencies
-			dps, err := depCmd.getDeepDependencies(args)
-			if err != nil {
-				return nil, err
-			}
-
-			// collect deps
-			deps = append(deps, dps...)
-		}
+// get the language for the current command
+func (c *command) getLanguage() (*Language, error) {
 
-		// replace args
-		out, err := replaceArgs(dep, argValues)
-		if err != nil {
-			return nil, err
-		}
+	ls.Lock()
+	defer ls.Unlock()
 
-		deps = append(deps, out)
+	if lang, ok := ls.items[c.language]; ok {
+		return lang, nil
 	}
 
-	return stripArrayRight(deps), nil
+	return nil, ErrUnsupportedLanguage
 }
 
-// execute dependencies for the current command
-// if their named outputs do not exist
-func (c *command) execDependencies(argValues map[string]string) error {
+// determine the stopOnError behavior for the command:
+// 1. use command-specific setting if available
+// 2. otherwise, fall back to global config
+func (c *command) shouldStopOnError() bool {
 
-	deps, err := c.getDeepDependencies(argValues)
-	if err != nil {
-		return err
+	if c.stopOnError != nil {
+		return *c.stopOnError
 	}
 
-	for _, depCommand := range deps {
-
-		fields := strings.Fields(depCommand)
-		if len(fields) == 0 {
-			return ErrEmptyDependency
-		}
-
-		// lookup
-		dep, err := cmdMap.getCommand(fields[0])
-		if err != nil {
-			return errors.New("invalid dependency: " + err.Error())
-		}
-
-		argBuffer, argValues, err := dep.parseArguments(fields[1:])
-		if err != nil {
-			return err
-		}
-
-		// check if dependency has outputs defined
-		if len(dep.outputs) > 0 {
+	conf.Lock()
+	defer conf.Unlock()
 
-			var outputMissing bool
+	return conf.fields.StopOnError
+}
 
-			// check if all named outputs exist
-			for _, output := range dep.outputs {
+// get the environment policy of the command, combined with the one of its commandsFile
+func (c *command) environment() *envData {
+	return mergeEnv(c.projectEnv, c.env)
+}
 
-				// replace args in output name
-				out, err := replaceArgs(output, argValues)
-				if err != nil {
-					return err
-				}
+// commandline of a command invocation
+type commandline struct {
 
-				// check if output exists
-				_, err = os.Stat(out)
-				if err != nil {
-					outputMissing = true
-				}
-			}
+	// interpreter, flags, the script and the passthrough arguments
+	argv []string
 
-			// no outputs missing - skip command
-			if !outputMissing {
+	// the fully assembled script, empty if a go source file is executed directly
+	script string
 
-				s.Lock()
-				s.currentCommand++
-				l.Println(printPrompt() + "[" + strconv.Itoa(s.currentCommand) + "/" + strconv.Itoa(s.numCommands) + "] skipping " + cp.Prompt + dep.name + cp.Reset)
-				s.Unlock()
+	// index of the script in argv, -1 if there is none
+	scriptIndex int
 
-				continue
-			}
-		}
+	// the script is written to a temporary file at execution time,
+	// the argument at scriptIndex is replaced with the path of the file
+	tempFile bool
 
-		// execute dependency and pass args
-		err = dep.AtomicRun(argBuffer, argValues, fields[1:], c.async)
-		if err != nil {
-			Log.WithError(err).Error("failed to execute " + dep.name)
-			return err
-		}
-	}
-
-	return nil
+	lang    *Language
+	argMode string
 }
 
-// get the language for the current command
-func (c *command) getLanguage() (*Language, error) {
+// assemble the commandline for a command invocation.
+// this has no side effects, so it can also be used to print the execution plan
+// relative script paths are resolved from the workDir, if one is set
+func (c *command) commandline(argValues map[string]string, argBuffer string, rawArgs []string, workDir string) (*commandline, error) {
 
-	ls.Lock()
-	defer ls.Unlock()
-
-	if lang, ok := ls.items[c.language]; ok {
-		return lang, nil
+	lang, err := c.getLanguage()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrUnsupportedLanguage
-}
-
-// create an exec.Cmd instance ready for execution
-// for the given argument buffer
-func (c *command) createCommand(argValues map[string]string, argBuffer string, rawArgs []string) (cmd *exec.Cmd, script string, cleanupFunc func(), err error) {
-
-	var (
-		shellCommand []string
-		globalFuncs  string
-	)
+	stopOnErr := c.shouldStopOnError()
 
-	if c.async {
-		shellCommand = append(shellCommand, []string{"screen", "-L", "-S", c.name, "-dm"}...)
+	// arguments after -- are passed to the script, the others have been parsed already
+	labeled, passthrough, err := normalizeArgs(c.args, rawArgs)
+	if err != nil {
+		return nil, err
 	}
 
-	lang, err := c.getLanguage()
-	if err != nil {
-		return
+	// the arguments are only declared in the script in inject mode
+	argMode := c.argumentMode(lang)
+	if argMode != argModeInject {
+		argBuffer = ""
+		labeled = nil
 	}
 
-	// Determine stopOnError behavior:
-	// 1. Use command-specific setting if available
-	// 2. Otherwise, fall back to global config
-	var stopOnErr bool
-	if c.stopOnError != nil {
-		stopOnErr = *c.stopOnError
-	} else {
-		conf.Lock()
-		stopOnErr = conf.fields.StopOnError
-		conf.Unlock()
+	cl := &commandline{
+		scriptIndex: -1,
+		lang:        lang,
+		argMode:     argMode,
 	}
 
 	// add interpreter
-	shellCommand = append(shellCommand, lang.Interpreter)
+	cl.argv = append(cl.argv, lang.Interpreter)
 
 	// add extra args if set
 	if len(lang.Args) > 0 {
-		shellCommand = append(shellCommand, lang.Args...)
+		cl.argv = append(cl.argv, lang.Args...)
 	}
 
 	if stopOnErr && lang.FlagStopOnError != "" {
-		shellCommand = append(shellCommand, lang.FlagStopOnError)
+		cl.argv = append(cl.argv, lang.FlagStopOnError)
 	}
 	if lang.FlagEvaluateScript != "" {
-		shellCommand = append(shellCommand, lang.FlagEvaluateScript)
-	}
-
-	// add language specific global code
-	code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
-	if err == nil {
-		globalFuncs = string(code)
+		cl.argv = append(cl.argv, lang.FlagEvaluateScript)
 	}
 
 	// check if loaded via CommandsFile
 	if c.exec != "" {
-		script = lang.Bang + "\n" + globalFuncs + "\n" + argBuffer + "\n" + c.exec
+		cl.script = lang.Bang + "\n" + globalCode(lang, c.exec) + "\n" + argBuffer + "\n" + c.exec
+		cl.scriptIndex = len(cl.argv)
+		cl.argv = append(cl.argv, cl.script)
+		cl.tempFile = lang.UseTempFile
 		if lang.UseTempFile {
-			// make sure the .tmp dir exists
-			os.MkdirAll(scriptDir+"/.tmp", 0700)
-			filename := scriptDir + "/.tmp/" + c.name + "_" + randomString() + lang.FileExtension
-			f, err := os.Create(filename)
-			if err != nil {
-				Log.WithError(err).Error("failed to create tmp dir")
-				return nil, "", nil, err
-			}
-			defer f.Close()
-			f.WriteString(script)
+			cl.argv = append(cl.argv, passthrough...)
+		} else {
+			cl.argv = c.appendPassthrough(lang, cl.argv, passthrough)
+		}
+		return cl, nil
+	}
 
-			// make temp script executable
-			err = os.Chmod(filename, 0700)
-			if err != nil {
-				Log.Error("failed to make script executable")
-				return nil, "", nil, err
-			}
+	var path = c.path
+	if c.path != "" {
 
-			shellCommand = append(shellCommand, filename)
+		// handle args in path
+		p, err := replaceArgs(c.path, c.joinArgs(argValues))
+		if err != nil {
+			return nil, err
+		}
 
-			// remove the generated tempfile
-			cleanupFunc = func() {
-				os.Remove(filename)
-			}
-		} else {
-			shellCommand = append(shellCommand, script)
+		path = p
+	}
+
+	if lang.Name == "go" {
+		// make an exception for golang: invoke the source file directly and pass the args on the commandline
+		cl.argv = append(cl.argv, path)
+		cl.argv = append(cl.argv, labeled...)
+		if len(passthrough) > 0 && len(labeled) > 0 {
+			cl.argv = append(cl.argv, "--")
 		}
-	} else {
+		if len(passthrough) > 0 {
+			cl.argv = append(cl.argv, passthrough...)
+		}
+		return cl, nil
+	}
 
-		var path = c.path
-		if c.path != "" {
+	if workDir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
 
-			// handle args in path
-			p, err := replaceArgs(c.path, argValues)
-			if err != nil {
-				return nil, "", nil, err
-			}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		Log.Error("failed to read script")
+		return nil, err
+	}
+
+	cl.script = lang.Bang + "\n" + globalCode(lang, string(contents)) + "\n" + argBuffer + "\n" + string(contents)
+	cl.scriptIndex = len(cl.argv)
+	cl.argv = append(cl.argv, cl.script)
+	cl.argv = c.appendPassthrough(lang, cl.argv, passthrough)
+
+	return cl, nil
+}
+
+// create an exec.Cmd instance ready for execution
+// for the given argument buffer
+// relative script paths are resolved from the workDir, if one is set
+func (c *command) createCommand(argValues map[string]string, argBuffer string, rawArgs []string, workDir string) (cmd *exec.Cmd, script string, cleanupFunc func(), err error) {
 
-			path = p
+	cl, err := c.commandline(argValues, argBuffer, rawArgs, workDir)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	script = cl.script
+
+	var (
+		lang         = cl.lang
+		argMode      = cl.argMode
+		shellCommand = cl.argv
+	)
+
+	if cl.tempFile {
+		// make sure the .tmp dir exists
+		os.MkdirAll(scriptDir+"/.tmp", 0700)
+		filename, err := filepath.Abs(scriptDir + "/.tmp/" + c.name + "_" + randomString() + lang.FileExtension)
+		if err != nil {
+			return nil, "", nil, err
 		}
+		f, err := os.Create(filename)
+		if err != nil {
+			Log.WithError(err).Error("failed to create tmp dir")
+			return nil, "", nil, err
+		}
+		defer f.Close()
+		f.WriteString(script)
 
-		if lang.Name == "go" {
-			// make an exception for golang: invoke the source file directly and pass raw args on the commandline
-			shellCommand = append(shellCommand, path)
-			shellCommand = append(shellCommand, rawArgs...)
-		} else {
+		// make temp script executable
+		err = os.Chmod(filename, 0700)
+		if err != nil {
+			Log.Error("failed to make script executable")
+			return nil, "", nil, err
+		}
 
-			contents, err := ioutil.ReadFile(path)
-			if err != nil {
-				Log.Error("failed to read script")
-				return nil, "", nil, err
-			}
+		shellCommand[cl.scriptIndex] = filename
 
-			script = lang.Bang + "\n" + globalFuncs + "\n" + argBuffer + "\n" + string(contents)
-			shellCommand = append(shellCommand, script)
+		// remove the generated tempfile
+		cleanupFunc = func() {
+			os.Remove(filename)
 		}
 	}
 
 	Log.Debug("shellCommand: ", shellCommand)
 
 	cmd = exec.Command(shellCommand[0], shellCommand[1:]...)
+	cmd.Dir = workDir
+
+	// the variables for the arguments are added to the environment of the command when it is executed
+	switch argMode {
+	case argModeEnv:
+		cmd.Env = c.argEnv(argValues)
+	case argModeJSON:
+		file, err := c.writeArgsFile(argValues)
+		if err != nil {
+			if cleanupFunc != nil {
+				cleanupFunc()
+			}
+			return nil, "", nil, err
+		}
+		cmd.Env = []string{argsFileEnv + "=" + file}
+
+		removeScript := cleanupFunc
+		cleanupFunc = func() {
+			os.Remove(file)
+			if removeScript != nil {
+				removeScript()
+			}
+		}
+	}
+
+	// apply resource limits before the interpreter is executed
+	if c.limits != nil {
+		err = c.limits.apply(cmd)
+		if err != nil {
+			if cleanupFunc != nil {
+				cleanupFunc()
+			}
+			return nil, "", nil, err
+		}
+	}
+
+	// run the command in a sandbox, the writable paths are prepared before starting it
+	if c.sandbox != nil {
+		outputs, err := c.expandAll(c.outputs, argValues)
+		if err != nil {
+			if cleanupFunc != nil {
+				cleanupFunc()
+			}
+			return nil, "", nil, err
+		}
+		removeDirs, err := c.sandbox.apply(cmd, outputs)
+		if err != nil {
+			if cleanupFunc != nil {
+				cleanupFunc()
+			}
+			return nil, "", nil, err
+		}
+		removeScript := cleanupFunc
+		cleanupFunc = func() {
+			removeDirs()
+			if removeScript != nil {
+				removeScript()
+			}
+		}
+	}
 
 	// in debug mode, print the complete script that will be executed
 	if conf.fields.Debug {
@@ -644,26 +848,26 @@ func (c *command) createCommand(argValues map[string]string, argBuffer string, r
 	return cmd, script, cleanupFunc, nil
 }
 
-/*
- *	Utils
- */
+// append the passthrough arguments to the commandline of a script that is evaluated by the interpreter.
+// shells use the first argument after the script as $0, so the command name is inserted
+func (c *command) appendPassthrough(lang *Language, shellCommand, passthrough []string) []string {
+
+	if len(passthrough) == 0 {
+		return shellCommand
+	}
 
-// get the default value for a commandArg's type
-func getDefaultValue(arg *commandArg) string {
-	switch arg.argType {
-	case reflect.String:
-		return ""
-	case reflect.Int:
-		return "0"
-	case reflect.Bool:
-		return "false"
-	case reflect.Float64:
-		return "0.0"
-	default:
-		return "unknown type"
+	switch lang.literalSyntax() {
+	case "bash", "sh", "zsh":
+		shellCommand = append(shellCommand, c.name)
 	}
+
+	return append(shellCommand, passthrough...)
 }
 
+/*
+ *	Utils
+ */
+
 // walk all scripts in the zeus dir and setup commandMap
 func findCommands() {
 
@@ -745,6 +949,25 @@ func (c *command) dump() {
 	fmt.Println(pad("#  buildNumber", w), c.buildNumber)
 	fmt.Println(pad("#  async", w), c.async)
 	fmt.Println(pad("#  outputs", w), c.outputs)
+	fmt.Println(pad("#  inputs", w), c.inputs)
+	fmt.Println(pad("#  timeout", w), c.timeout)
+	fmt.Println(pad("#  retries", w), c.retries)
+	fmt.Println(pad("#  retryDelay", w), c.retryDelay)
+	fmt.Println(pad("#  restart", w), c.restart)
+	fmt.Println(pad("#  maxRestarts", w), c.maxRestarts)
+	fmt.Println(pad("#  restartDelay", w), c.restartDelay)
+	if c.limits != nil {
+		fmt.Println(pad("#  limits", w), c.limits)
+	}
+	if c.sandbox != nil {
+		fmt.Println(pad("#  sandbox", w), c.sandbox)
+	}
+	if c.env != nil || c.projectEnv != nil {
+		fmt.Println(pad("#  env", w), c.environment())
+	}
+	if c.argMode != "" {
+		fmt.Println(pad("#  argMode", w), c.argMode)
+	}
 	if c.exec != "" {
 		fmt.Println(pad("#  exec", w))
 		for _, line := range strings.Split(c.exec, "\n") {
@@ -22,12 +22,9 @@ import (
 	"errors"
 	"strings"
 	"sync"
-
-	"github.com/mgutz/ansi"
 )
 
 type status struct {
-	recursionMap   map[string]int
 	numCommands    int
 	currentCommand int
 	sync.RWMutex
@@ -38,32 +35,9 @@ func (s *status) reset() {
 	s.Lock()
 	s.numCommands = 0
 	s.currentCommand = 0
-	s.recursionMap = make(map[string]int, 0)
 	s.Unlock()
 }
 
-func (s *status) incrementRecursionCount(commandName string) error {
-
-	conf.Lock()
-	limit := conf.fields.RecursionDepth
-	conf.Unlock()
-
-	s.Lock()
-	defer s.Unlock()
-
-	if val, ok := s.recursionMap[commandName]; ok {
-		if val == limit {
-			return errors.New("recursion limit for command " + commandName + " reached.")
-		}
-		s.recursionMap[commandName]++
-		Log.Debug("incremented recursion count for command "+ansi.Red+commandName+cp.Reset+" to: ", s.recursionMap[commandName])
-	} else {
-		s.recursionMap[commandName] = 1
-		Log.Debug("adding " + ansi.Red + commandName + cp.Reset + " to recursionMap")
-	}
-	return nil
-}
-
 type commandChain []*command
 
 // create a readable string from a commandChain
@@ -83,30 +57,61 @@ func (cmdChain commandChain) String() (out string) {
 }
 
 // parse and execute a given commandChain string
-func (cmdChain commandChain) exec(cmds []string) {
+// missing arguments are read with read, if it is not nil
+func (cmdChain commandChain) exec(cmds []string, read promptReader) {
 
 	defer s.reset()
 
-	// set numCommands counter
-	for _, c := range cmdChain {
-		count, err := getTotalDependencyCount(c)
-		if err != nil {
-			Log.WithError(err).Error("failed to get dependency count")
-			return
-		}
-		s.Lock()
-		s.numCommands += count
-		s.Unlock()
+	dg, err := cmdChain.graph(cmds, read)
+	if err != nil {
+		Log.WithError(err).Error("failed to resolve dependencies")
+		return
 	}
 
-	// exec and pass args
+	// errors are logged for each failed command during execution
+	_ = dg.exec()
+}
+
+// resolve the commandChain into a single dependency graph,
+// so that dependencies shared by multiple commands of the chain are only executed once.
+// the commands of the chain are executed in order, unless they are async.
+// missing arguments of all invocations are read with read, if it is not nil
+func (cmdChain commandChain) graph(cmds []string, read promptReader) (*depGraph, error) {
+
+	var (
+		dg   = newDepGraph()
+		prev *depNode
+	)
+	dg.read = read
+
 	for i, c := range cmdChain {
-		err := c.Run(strings.Fields(cmds[i])[1:], c.async)
+
+		before := len(dg.nodes)
+
+		n, err := dg.addRoot(c, strings.Fields(cmds[i])[1:])
 		if err != nil {
-			Log.WithError(err).Error("failed to execute " + c.name)
-			return
+			return nil, errors.New(c.name + ": " + err.Error())
+		}
+
+		// invocation has been resolved already for a previous command of the chain
+		if len(dg.nodes) == before {
+			continue
+		}
+
+		// everything that was added for the current command waits for the previous command
+		if prev != nil {
+			for _, added := range dg.nodes[before:] {
+				added.deps = append(added.deps, prev)
+			}
+		}
+
+		// async commands do not block the rest of the chain
+		if !c.async {
+			prev = n
 		}
 	}
+
+	return dg, nil
 }
 
 // check if its a valid command chain
@@ -143,10 +148,13 @@ func validCommandChain(commands []string, quiet bool) (commandChain, bool) {
 			}
 
 			// validate args
-			_, _, err = cmd.parseArguments(fields[1:])
-			if err != nil {
-				l.Println(err)
-				return nil, false
+			// missing arguments are asked for when the chain is resolved in the interactive shell
+			if quiet || !canPrompt() || !cmd.missingArgs(fields[1:]) {
+				_, _, err = cmd.parseArguments(fields[1:])
+				if err != nil {
+					l.Println(err)
+					return nil, false
+				}
 			}
 
 			if val, ok := recursionMap[cmd.name]; ok {
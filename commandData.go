@@ -25,6 +25,7 @@ import (
 	"os/user"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dreadl0ck/readline"
 )
@@ -51,10 +52,13 @@ type commandData struct {
 	// outputs
 	Outputs []string `yaml:"outputs"`
 
+	// inputs
+	Inputs []string `yaml:"inputs"`
+
 	// increase buildnumber on each execution
 	BuildNumber bool `yaml:"buildNumber"`
 
-	// execute command in a detached screen session
+	// execute command detached in the background
 	Async bool `yaml:"async"`
 
 	// Exec is the script to run when executed
@@ -75,6 +79,40 @@ type commandData struct {
 	// WorkingDir overwrites the working directory for this command
 	WorkingDir string `yaml:"workingDir"`
 
+	// Timeout is the maximum duration of a single execution, e.g. 30s or 5m
+	Timeout string `yaml:"timeout"`
+
+	// Retries is the number of times the command is executed again after a failure
+	Retries int `yaml:"retries"`
+
+	// RetryDelay is the duration to wait between attempts
+	RetryDelay string `yaml:"retryDelay"`
+
+	// Restart sets the restart policy for async commands: always or on-failure
+	Restart string `yaml:"restart"`
+
+	// MaxRestarts limits the number of restarts, zero means unlimited
+	MaxRestarts int `yaml:"maxRestarts"`
+
+	// RestartDelay is the initial delay before a restart, it doubles for every consecutive restart
+	RestartDelay string `yaml:"restartDelay"`
+
+	// HealthCheck is periodically executed for async commands
+	HealthCheck *healthCheckData `yaml:"healthCheck"`
+
+	// Limits for memory, CPU time and open files of the command
+	Limits *limitsData `yaml:"limits"`
+
+	// Sandbox runs the command with a read only filesystem and without network
+	Sandbox *sandboxData `yaml:"sandbox"`
+
+	// Env controls the environment variables of the command
+	Env *envData `yaml:"env"`
+
+	// ArgMode controls how arguments are passed: env, json or inject
+	// If not set, defaults to the argMode of the language
+	ArgMode string `yaml:"argMode"`
+
 	// StopOnError controls whether execution stops if this command encounters an error
 	// If not set, defaults to the global StopOnError config
 	StopOnError *bool `yaml:"stopOnError"`
@@ -121,23 +159,8 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 				if err != nil {
 					return err
 				}
-				var (
-					highlightLine  int
-					commandStarted bool
-				)
-				for index, line := range strings.Split(string(c), "\n") {
-					if strings.Contains(line, name+":") {
-						commandStarted = true
-					}
-					if commandStarted {
-						if strings.Contains(line, "- "+name) {
-							highlightLine = index
-							break
-						}
-					}
-				}
 
-				printCodeSnippet(string(c), commandsFilePath, highlightLine)
+				printCodeSnippet(string(c), commandsFilePath, findDependencyLine(string(c), name, name))
 				return errors.New("command " + name + " has itself as dependency at index: " + strconv.Itoa(index) + " This will result in a loop")
 			}
 		}
@@ -202,18 +225,7 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 
 			// completer for current commands arguments
 			readline.PcItemDynamic(func(path string) (res []string) {
-				var allRequiredArgsSet = true
-				for _, a := range args {
-					if !strings.Contains(path, a.name+"=") {
-						res = append(res, a.name+"=")
-						if !a.optional {
-							allRequiredArgsSet = false
-						}
-					}
-				}
-				if allRequiredArgsSet {
-					res = append(res, commandChainSeparator)
-				}
+				res = argCompletions(args, path)
 				// l.Println("\npath:", path)
 				// l.Println("result:", res)
 				return
@@ -257,18 +269,7 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 						// return the next commands completer?
 						// return c.PrefixCompleter.Callback(path)
 
-						var allRequiredArgsSet = true
-						for _, a := range c.args {
-							if !strings.Contains(path, a.name+"=") {
-								res = append(res, a.name+"=")
-								if !a.optional {
-									allRequiredArgsSet = false
-								}
-							}
-						}
-						if allRequiredArgsSet {
-							res = append(res, commandChainSeparator)
-						}
+						res = argCompletions(c.args, slice[len(slice)-1])
 
 						// l.Println("\npath:", path)
 						// l.Println("result:", res)
@@ -280,12 +281,87 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		buildNumber:     d.BuildNumber,
 		dependencies:    d.Dependencies,
 		outputs:         d.Outputs,
+		inputs:          d.Inputs,
 		exec:            d.Exec,
 		async:           d.Async,
 		language:        lang,
 		canModifyPrompt: d.CanModifyPrompt,
 		extends:         d.Extends,
 		stopOnError:     d.StopOnError,
+		retries:         d.Retries,
+		restart:         d.Restart,
+		maxRestarts:     d.MaxRestarts,
+		argMode:         d.ArgMode,
+	}
+
+	if d.Timeout != "" {
+		cmd.timeout, err = time.ParseDuration(d.Timeout)
+		if err != nil {
+			return errors.New("invalid timeout for command " + name + ": " + err.Error())
+		}
+	}
+
+	if d.RetryDelay != "" {
+		cmd.retryDelay, err = time.ParseDuration(d.RetryDelay)
+		if err != nil {
+			return errors.New("invalid retryDelay for command " + name + ": " + err.Error())
+		}
+	}
+
+	if d.Retries < 0 {
+		return errors.New("invalid retries for command " + name + ": must not be negative")
+	}
+
+	switch d.Restart {
+	case "", restartAlways, restartOnFailure:
+	default:
+		return errors.New("invalid restart policy for command " + name + ": " + d.Restart + ", expected always or on-failure")
+	}
+
+	if d.MaxRestarts < 0 {
+		return errors.New("invalid maxRestarts for command " + name + ": must not be negative")
+	}
+
+	if d.RestartDelay != "" {
+		cmd.restartDelay, err = time.ParseDuration(d.RestartDelay)
+		if err != nil {
+			return errors.New("invalid restartDelay for command " + name + ": " + err.Error())
+		}
+	}
+
+	if d.Limits != nil {
+		cmd.limits, err = d.Limits.init(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Env != nil {
+		err = d.Env.validate("for command " + name)
+		if err != nil {
+			return err
+		}
+		cmd.env = d.Env
+	}
+	cmd.projectEnv = commandsFile.Env
+
+	err = validateArgMode(d.ArgMode, "for command "+name)
+	if err != nil {
+		return err
+	}
+
+	if d.Sandbox != nil {
+		cmd.sandbox, err = d.Sandbox.init(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HealthCheck != nil {
+		cmd.healthCheck, err = d.HealthCheck.init(name)
+		if err != nil {
+			return err
+		}
 	}
 
 	if d.Path != "" {
@@ -308,7 +384,10 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		}
 
 		// 2) expand ZEUS globals
-		p = commandsFile.replaceGlobals(p)
+		p, err = commandsFile.replaceGlobals(p)
+		if err != nil {
+			return err
+		}
 
 		// 3) update workingDir
 		cmd.path = p
@@ -335,7 +414,10 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 		}
 
 		// 2) expand ZEUS globals
-		workDir = commandsFile.replaceGlobals(workDir)
+		workDir, err = commandsFile.replaceGlobals(workDir)
+		if err != nil {
+			return err
+		}
 
 		// 3) update workingDir
 		cmd.workingDir = workDir
@@ -347,12 +429,26 @@ func (d *commandData) init(commandsFile *CommandsFile, name string) error {
 
 	// replace globals in outputs
 	for i, o := range cmd.outputs {
-		cmd.outputs[i] = commandsFile.replaceGlobals(o)
+		cmd.outputs[i], err = commandsFile.replaceGlobals(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	// replace globals in inputs
+	for i, in := range cmd.inputs {
+		cmd.inputs[i], err = commandsFile.replaceGlobals(in)
+		if err != nil {
+			return err
+		}
 	}
 
 	// replace globals in dependencies
 	for i, dep := range cmd.dependencies {
-		cmd.dependencies[i] = commandsFile.replaceGlobals(dep)
+		cmd.dependencies[i], err = commandsFile.replaceGlobals(dep)
+		if err != nil {
+			return err
+		}
 	}
 
 	// disable completion for hidden commands
@@ -26,6 +26,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,7 +50,14 @@ type CommandsFile struct {
 	Language string `yaml:"language"`
 
 	// global vars for all commands
-	Globals map[string]string `yaml:"globals"`
+	// the type can be declared in the key: name:Type
+	Globals map[string]*globalValue `yaml:"globals"`
+
+	// environment policy for all commands
+	Env *envData `yaml:"env"`
+
+	// secrets that can be referenced in globals and arguments as ${secret:name}
+	Secrets map[string]*secretData `yaml:"secrets"`
 
 	// command data
 	Commands map[string]*commandData `yaml:"commands"`
@@ -72,7 +80,7 @@ type CommandsFile struct {
 func newCommandsFile() *CommandsFile {
 	return &CommandsFile{
 		Language: "bash",
-		Globals:  make(map[string]string, 0),
+		Globals:  make(map[string]*globalValue, 0),
 		Commands: make(map[string]*commandData, 0),
 	}
 }
@@ -120,31 +128,67 @@ func parseCommandsFile(path string, flush bool) (*CommandsFile, error) {
 		return nil, errors.New(commandsFilePath + ": " + err.Error() + ": " + ansi.Red + commandsFile.Language + cp.Text)
 	}
 
+	if commandsFile.Env != nil {
+		err = commandsFile.Env.validate("in " + commandsFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if flush {
 		// flush command map
 		cmdMap.flush()
-		g = &globals{
-			Vars: make(map[string]string, 0),
-		}
+		g = newGlobals()
+		secrets.reset()
+	}
+
+	err = secrets.add(commandsFile.Secrets)
+	if err != nil {
+		return nil, errors.New(commandsFilePath + ": " + err.Error())
 	}
 
 	if len(commandsFile.Globals) > 0 {
-		if g != nil {
-			for k, v := range commandsFile.Globals {
-				g.Vars[k] = v
+		if g == nil {
+			g = newGlobals()
+		}
+
+		// validate the globals and resolve environment vars used in the values
+		parsed := make(map[string]*globalVar, len(commandsFile.Globals))
+		for key, v := range commandsFile.Globals {
+			gl, err := parseGlobal(key, v)
+			if err != nil {
+				return nil, errors.New(commandsFilePath + ": " + err.Error())
 			}
-		} else {
-			// init
-			g = &globals{
-				Vars: commandsFile.Globals,
+			if _, ok := parsed[gl.name]; ok {
+				return nil, errors.New(commandsFilePath + ": duplicate global: " + gl.name)
+			}
+			parsed[gl.name] = gl
+
+			// computed globals without a ttl are evaluated once, when the commandsFile is parsed
+			if gl.shell != "" {
+				line := findGlobalLine(string(contents), key)
+				gl.source = commandsFilePath + ": "
+				if line > 0 {
+					gl.source = commandsFilePath + ":" + strconv.Itoa(line) + ": "
+				}
+				if gl.ttl == 0 {
+					err = gl.evaluate()
+					if err != nil {
+						if !shellBusy {
+							printCodeSnippet(string(contents), commandsFilePath, line)
+						}
+						return nil, err
+					}
+				}
 			}
 		}
 
-		// resolve environment vars used in the globals
-		// must be in format ${VAR}
-		for k, v := range g.Vars {
-			g.Vars[k] = resolveEnvironment(v)
+		g.Lock()
+		for name, gl := range parsed {
+			g.Vars[name] = gl.String()
+			g.Values[name] = gl
 		}
+		g.Unlock()
 	}
 
 	// initialize commands
@@ -168,12 +212,20 @@ func parseCommandsFile(path string, flush bool) (*CommandsFile, error) {
 		return nil, err
 	}
 
-	// set working directory for all commands that are from the current commandsFile
+	// the commandsFile of an extension is parsed from within its own directory
+	// so remember its absolute path to locate the declarations of its commands later on
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// set working directory and source for all commands that are from the current commandsFile
 	for name := range commandsFile.Commands {
 		if cmd, ok := cmdMap.items[name]; ok {
 			if cmd.workingDir == "" {
 				cmd.workingDir = wd
 			}
+			cmd.source = source
 		}
 	}
 
@@ -194,6 +246,9 @@ func parseCommandsFile(path string, flush bool) (*CommandsFile, error) {
 				// prepend outputs from base command
 				cmd.outputs = append(baseCmd.outputs, cmd.outputs...)
 
+				// prepend inputs from base command
+				cmd.inputs = append(baseCmd.inputs, cmd.inputs...)
+
 				// if no description is provided for the current command, use the one from the base command.
 				if cmd.description == "" {
 					cmd.description = baseCmd.description
@@ -219,12 +274,77 @@ func parseCommandsFile(path string, flush bool) (*CommandsFile, error) {
 				if cmd.path == "" && baseCmd.path != "" {
 					cmd.path = baseCmd.path
 				}
+
+				// inherit timeout and retry policy if not set
+				if cmd.timeout == 0 {
+					cmd.timeout = baseCmd.timeout
+				}
+				if cmd.retries == 0 {
+					cmd.retries = baseCmd.retries
+				}
+				if cmd.retryDelay == 0 {
+					cmd.retryDelay = baseCmd.retryDelay
+				}
+
+				// inherit restart policy and health check if not set
+				if cmd.restart == "" {
+					cmd.restart = baseCmd.restart
+				}
+				if cmd.maxRestarts == 0 {
+					cmd.maxRestarts = baseCmd.maxRestarts
+				}
+				if cmd.restartDelay == 0 {
+					cmd.restartDelay = baseCmd.restartDelay
+				}
+				if cmd.healthCheck == nil {
+					cmd.healthCheck = baseCmd.healthCheck
+				}
+
+				// inherit resource limits if not set
+				if cmd.limits == nil {
+					cmd.limits = baseCmd.limits
+				}
+				if cmd.sandbox == nil {
+					cmd.sandbox = baseCmd.sandbox
+				}
+				if cmd.env == nil {
+					cmd.env = baseCmd.env
+				}
+				if cmd.argMode == "" {
+					cmd.argMode = baseCmd.argMode
+				}
 			} else {
 				return nil, errors.New("base command not found: " + cmd.extends)
 			}
 		}
 	}
 
+	// check for dependency cycles across all commands
+	// when a commandsFile extends or includes another one, it is parsed again after the merge
+	// so the check covers the dependencies between both files as well
+	if cycle := findCycle(cmdMap.items); cycle != nil {
+
+		// highlight the dependency that closes the cycle
+		var (
+			name = cycle[len(cycle)-2]
+			dep  = cycle[len(cycle)-1]
+		)
+		// the dependency might have been declared in the commandsFile of an extension
+		// if it cannot be located, only the cycle is reported
+		if !shellBusy {
+			if file, i := findDependencyDeclaration(name, dep); i > 0 {
+				if contents, err := ioutil.ReadFile(file); err == nil {
+					if rel, err := filepath.Rel(wd, file); err == nil {
+						file = rel
+					}
+					printCodeSnippet(string(contents), file, i)
+				}
+			}
+		}
+
+		return nil, errors.New("dependency cycle detected: " + formatDependencies(cycle))
+	}
+
 	// only print info when using the interactive shell
 	if len(os.Args) == 1 {
 		if conf.fields.Debug {
@@ -294,18 +414,14 @@ func watchCommandsFile(path, eventID string) {
 			if err != nil {
 				// flush command map
 				cmdMap.flush()
-				g = &globals{
-					Vars: make(map[string]string, 0),
-				}
+				g = newGlobals()
 				Log.WithError(err).Error("failed to parse commandsFile")
 			}
 		} else {
 			if err != nil {
 				// flush command map
 				cmdMap.flush()
-				g = &globals{
-					Vars: make(map[string]string, 0),
-				}
+				g = newGlobals()
 				// shell is currently busy. store the error to present it to the user once the shell is free again.
 				lastCommandsFileError = err
 			} else {
@@ -507,4 +623,31 @@ func (c *CommandsFile) handleInclusion() {
 			os.Exit(1)
 		}
 	}
-}
\ No newline at end of file
+}
+// locate the commandsFile and line that declare the dependency of the named command on dep
+// dependencies inherited from a base command are searched in the commandsFile of the base command
+// returns a line of -1 if the declaration could not be found
+// cmdMap must be locked by the caller
+func findDependencyDeclaration(name, dep string) (file string, line int) {
+
+	visited := make(map[string]bool)
+	for name != "" && !visited[name] {
+		visited[name] = true
+
+		cmd, ok := cmdMap.items[name]
+		if !ok || cmd.source == "" {
+			break
+		}
+
+		contents, err := ioutil.ReadFile(cmd.source)
+		if err == nil {
+			if i := findDependencyLine(string(contents), name, dep); i > 0 {
+				return cmd.source, i
+			}
+		}
+
+		name = cmd.extends
+	}
+
+	return "", -1
+}
@@ -72,6 +72,10 @@ func configItems() []readline.PrefixCompleterInterface {
 		readline.PcItem("interactive", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("debug", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("recursionDepth"),
+		readline.PcItem("maxParallel"),
+		readline.PcItem("logFormat", readline.PcItem("text"), readline.PcItem("json")),
+		readline.PcItem("shutdownGracePeriod"),
+		readline.PcItem("eventStream"),
 		readline.PcItem("projectNamePrompt", readline.PcItem("true"), readline.PcItem("false")),
 		readline.PcItem("colorProfile"),
 		readline.PcItem("historyFile", readline.PcItem("true"), readline.PcItem("false")),
@@ -193,6 +197,33 @@ func newCompleter() *readline.PrefixCompleter {
 		readline.PcItem(generateCommand,
 			readline.PcItemDynamic(commandCompleter),
 		),
+		readline.PcItem(reportCommand,
+			readline.PcItem("terminal"),
+			readline.PcItem("markdown"),
+			readline.PcItem("html"),
+		),
+		readline.PcItem(secretsCommand,
+			readline.PcItem("set"),
+			readline.PcItem("remove"),
+		),
+		readline.PcItem(explainCommand,
+			readline.PcItemDynamic(commandCompleter),
+		),
+		readline.PcItem(graphCommand,
+			readline.PcItem("ascii",
+				readline.PcItemDynamic(commandCompleter),
+			),
+			readline.PcItem("dot",
+				readline.PcItemDynamic(commandCompleter),
+			),
+			readline.PcItem("mermaid",
+				readline.PcItemDynamic(commandCompleter),
+			),
+			readline.PcItem("json",
+				readline.PcItemDynamic(commandCompleter),
+			),
+			readline.PcItemDynamic(commandCompleter),
+		),
 		readline.PcItem(colorsCommand,
 			readline.PcItem("off"),
 			readline.PcItem("default"),
@@ -241,6 +272,9 @@ func newCompleter() *readline.PrefixCompleter {
 			readline.PcItem("attach",
 				readline.PcItemDynamic(pIDCompleter),
 			),
+			readline.PcItem("logs",
+				readline.PcItemDynamic(procNameCompleter),
+			),
 		),
 		readline.PcItem(wikiCommand),
 		// completions for common shell commands
@@ -337,14 +371,26 @@ func todoIndexCompleter(path string) (res []string) {
 
 // complete PIDs for killing processes
 func pIDCompleter(path string) (res []string) {
-	projectData.Lock()
-	defer projectData.Unlock()
+	processMapMutex.Lock()
+	defer processMapMutex.Unlock()
 	for _, p := range processMap {
 		res = append(res, strconv.Itoa(p.PID))
 	}
 	return
 }
 
+// complete the command names of detached processes
+func procNameCompleter(path string) (res []string) {
+	processMapMutex.Lock()
+	defer processMapMutex.Unlock()
+	for _, p := range processMap {
+		if p.Async {
+			res = append(res, p.Name)
+		}
+	}
+	return
+}
+
 // complete available filetypes for the event target directory
 func fileTypeCompleter(path string) (res []string) {
 
@@ -390,6 +436,91 @@ func fileTypeCompleter(path string) (res []string) {
 	return out
 }
 
+// completions for the arguments of a command, line contains the command and the arguments typed so far.
+// arguments that are set already are skipped, values are completed for Bool, Enum, Path and List arguments
+func argCompletions(args []*commandArg, line string) (res []string) {
+
+	var (
+		fields             = strings.Fields(line)
+		current            string
+		allRequiredArgsSet = true
+		set                = make(map[string]bool)
+	)
+
+	// the last field is being typed, unless the line ends with a space
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+		current = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) > 0 {
+		// skip the command name
+		fields = fields[1:]
+	}
+
+	for _, f := range fields {
+		// everything after -- is passed to the script
+		if f == "--" {
+			return nil
+		}
+	}
+
+	// the value of a flag is being typed
+	if n := len(fields); n > 0 && isFlag(fields[n-1]) {
+		if a, _, hasValue := lookupFlag(args, fields[n-1]); a != nil && !hasValue && a.argType.name != argTypeBool {
+			return a.argType.complete(current)
+		}
+	}
+
+	labeled, _, err := normalizeArgs(args, fields)
+	if err == nil {
+		for _, kv := range labeled {
+			set[strings.SplitN(kv, "=", 2)[0]] = true
+		}
+	}
+
+	for _, a := range args {
+		if set[a.name] {
+			// variadic arguments can be passed again
+			if !a.argType.variadic {
+				continue
+			}
+		} else if !a.optional {
+			allRequiredArgsSet = false
+		}
+
+		// flags are completed once a dash has been typed
+		label := a.name + "="
+		if strings.HasPrefix(current, "-") {
+			label = "--" + label
+			if !strings.HasPrefix(current, label) {
+				res = append(res, "--"+a.name)
+				continue
+			}
+		}
+
+		// the values of Bool and Enum arguments are listed right away
+		if strings.HasPrefix(current, label) || a.argType.name == argTypeBool || a.argType.name == argTypeEnum {
+			values := a.argType.complete(strings.TrimPrefix(current, label))
+			for _, v := range values {
+				res = append(res, label+v)
+			}
+			if len(values) > 0 {
+				continue
+			}
+		}
+		res = append(res, label)
+	}
+
+	if strings.HasPrefix(current, "-") {
+		res = append(res, "--")
+	}
+	if allRequiredArgsSet {
+		res = append(res, commandChainSeparator)
+	}
+
+	return
+}
+
 // return available directories
 func directoryCompleter(path string) (names []string) {
 
@@ -72,6 +72,7 @@ type configFields struct {
 	Debug               bool                     `yaml:"debug"`
 	ProjectNamePrompt   bool                     `yaml:"projectNamePrompt"`
 	RecursionDepth      int                      `yaml:"recursionDepth"`
+	MaxParallel         int                      `yaml:"maxParallel"`
 	HistoryLimit        int                      `yaml:"historyLimit"`
 	CodeSnippetScope    int                      `yaml:"codeSnippetScope"`
 	PortWebPanel        int                      `yaml:"portWebPanel"`
@@ -88,6 +89,9 @@ type configFields struct {
 	DateFormat          string                   `yaml:"dateFormat"`
 	TodoFilePath        string                   `yaml:"todoFilePath"`
 	Editor              string                   `yaml:"editor"`
+	LogFormat           string                   `yaml:"logFormat"`
+	EventStream         string                   `yaml:"eventStream"`
+	ShutdownGracePeriod string                   `yaml:"shutdownGracePeriod"`
 	ColorProfiles       map[string]*ColorProfile `yaml:"colorProfiles"`
 	Languages           []*Language              `yaml:"languages"`
 }
@@ -106,6 +110,7 @@ func newConfig() *config {
 			ProjectNamePrompt:   true,
 			HistoryFile:         true,
 			RecursionDepth:      1,
+			MaxParallel:         1,
 			HistoryLimit:        20,
 			PortWebPanel:        8080,
 			CodeSnippetScope:    15,
@@ -115,10 +120,12 @@ func newConfig() *config {
 			StopOnError:         true,
 			DumpScriptOnError:   false,
 			Quiet:               false,
+			ShutdownGracePeriod: "5s",
 			// default: german date format DD-MM-YYYY
 			DateFormat:   "02-01-2006",
 			TodoFilePath: "TODO.md",
 			Editor:       "micro",
+			LogFormat:    "text",
 			ColorProfile: "default",
 			ColorProfiles: map[string]*ColorProfile{
 				"light": lightProfile(),
@@ -203,6 +210,18 @@ func parseProjectConfig() (c *config, warnings []string, err error) {
 		return nil, warnings, err
 	}
 
+	for _, lang := range c.fields.Languages {
+		err = validateArgMode(lang.ArgMode, "for language "+lang.Name)
+		if err != nil {
+			return nil, warnings, err
+		}
+	}
+
+	err = validateLogFormat(c.fields.LogFormat)
+	if err != nil {
+		return nil, warnings, err
+	}
+
 	c.handle()
 
 	return c, warnings, nil
@@ -325,14 +344,18 @@ func (c *config) watch(eventID string) {
 		c.Lock()
 
 		// reinit the config structure: strict parsing will throw an error if keys are already set in a map.
-		c.fields = new(configFields)
+		fields := new(configFields)
 
-		err = yaml.UnmarshalStrict(contents, c.fields)
+		err = yaml.UnmarshalStrict(contents, fields)
+		if err == nil {
+			err = validateLogFormat(fields.LogFormat)
+		}
 		if err != nil {
 			Log.WithError(err).Error("config parse error")
 			c.Unlock()
 			return
 		}
+		c.fields = fields
 		c.Unlock()
 
 		// handle updated values
@@ -411,6 +434,12 @@ func (c *config) setValue(field, value string) {
 
 		Log.Info("set config field ", field, " to ", value)
 	case reflect.String:
+		if field == "logFormat" {
+			if err := validateLogFormat(value); err != nil {
+				Log.WithError(err).Error("invalid value: ", value)
+				return
+			}
+		}
 		f.SetString(value)
 		Log.Info("set config field ", field, " to ", value)
 	default:
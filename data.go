@@ -179,7 +179,7 @@ func loadEvents() {
 
 				// validate commandChain
 				if cmdChain, ok := validCommandChain(fields, true); ok {
-					cmdChain.exec(fields)
+					cmdChain.exec(fields, nil)
 				} else {
 
 					Log.Debug("passing command to shell: ", fields)
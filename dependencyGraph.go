@@ -0,0 +1,438 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// depNode is a single command invocation inside a dependency graph
+type depNode struct {
+
+	// identifies the invocation inside the graph
+	key string
+
+	// invocation key with secret values masked, used for displaying and recording the invocation
+	label string
+
+	// command to execute
+	cmd *command
+
+	// arguments as supplied by the user or the dependency declaration
+	rawArgs []string
+
+	// parsed arguments
+	argBuffer string
+	argValues map[string]string
+
+	// arguments after -- that are passed to the script
+	passthrough []string
+
+	// nodes that must have finished before this node can be started
+	deps []*depNode
+}
+
+// depGraph contains all command invocations required to execute a command.
+// nodes are stored in topological order: every node appears after all of its dependencies,
+// and independent nodes keep the order in which they were declared.
+type depGraph struct {
+	nodes []*depNode
+	index map[string]*depNode
+
+	// invocations that are currently being resolved
+	// used to guard against dependency cycles
+	visiting map[string]bool
+
+	// the invocations requested by the user
+	roots []*depNode
+
+	// reads missing arguments of invocations
+	// nil if all arguments must be supplied
+	read promptReader
+}
+
+func newDepGraph() *depGraph {
+	return &depGraph{
+		index:    make(map[string]*depNode),
+		visiting: make(map[string]bool),
+	}
+}
+
+// add a command invocation as root of the graph
+func (dg *depGraph) addRoot(c *command, args []string) (*depNode, error) {
+	n, err := dg.add(c, args)
+	if err != nil {
+		return nil, err
+	}
+	dg.roots = append(dg.roots, n)
+	return n, nil
+}
+
+// add a command invocation and, recursively, all of its dependencies to the graph.
+// invocations that are already part of the graph are reused.
+func (dg *depGraph) add(c *command, args []string) (*depNode, error) {
+
+	if dg.read != nil {
+		var err error
+		args, err = c.promptArgs(args, dg.read)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	argBuffer, argValues, err := c.parseArguments(args)
+	if err != nil {
+		return nil, err
+	}
+
+	passthrough := c.passthroughArgs(args)
+
+	key := invocationKey(c.name, argValues, passthrough)
+	if n, ok := dg.index[key]; ok {
+		return n, nil
+	}
+
+	// cycles are rejected when parsing the commandsFile already, this is just a safety net
+	if dg.visiting[key] {
+		return nil, errors.New("dependency cycle detected for command: " + c.name)
+	}
+	dg.visiting[key] = true
+	defer delete(dg.visiting, key)
+
+	n := &depNode{
+		key:         key,
+		label:       invocationKey(c.name, maskSecretArgs(argValues), maskSecretList(passthrough)),
+		cmd:         c,
+		rawArgs:     args,
+		argBuffer:   argBuffer,
+		argValues:   argValues,
+		passthrough: passthrough,
+	}
+
+	for _, dep := range c.dependencies {
+
+		// replace args, a dependency is added once per value of a variadic argument
+		expanded, err := c.expandArgs(dep, argValues)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, out := range expanded {
+
+			fields := strings.Fields(out)
+			if len(fields) == 0 {
+				continue
+			}
+
+			// lookup dep command
+			depCmd, err := cmdMap.getCommand(fields[0])
+			if err != nil {
+				return nil, errors.New("invalid dependency: " + err.Error())
+			}
+
+			Log.Debug("depGraph: ", c.name, " depends on ", depCmd.name, " ", fields[1:])
+
+			d, err := dg.add(depCmd, fields[1:])
+			if err != nil {
+				return nil, err
+			}
+
+			n.deps = append(n.deps, d)
+		}
+	}
+
+	// all dependencies have been added at this point
+	dg.nodes = append(dg.nodes, n)
+	dg.index[key] = n
+
+	return n, nil
+}
+
+// search the dependencies of all commands for a cycle.
+// returns the path of the first cycle found, e.g. [a b a], or nil if there is none.
+// dependencies on unknown commands are ignored.
+func findCycle(items map[string]*command) []string {
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	var (
+		state = make(map[string]int)
+		stack []string
+		visit func(name string) []string
+	)
+
+	visit = func(name string) []string {
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, dep := range items[name].dependencies {
+
+			fields := strings.Fields(dep)
+			if len(fields) == 0 {
+				continue
+			}
+			if _, ok := items[fields[0]]; !ok {
+				continue
+			}
+
+			switch state[fields[0]] {
+			case visiting:
+				// found a cycle: extract the path from the first occurrence of the dependency
+				for i, n := range stack {
+					if n == fields[0] {
+						return append(append([]string{}, stack[i:]...), fields[0])
+					}
+				}
+			case unvisited:
+				if cycle := visit(fields[0]); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = done
+
+		return nil
+	}
+
+	// sort names to get a stable result
+	var names []string
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// identify an invocation by the command name, its concrete argument values and the arguments passed through to the script.
+// this way equivalent invocations map to the same node,
+// regardless of argument order or whether default values have been supplied explicitly.
+func invocationKey(name string, argValues map[string]string, passthrough []string) string {
+
+	var names []string
+	for n := range argValues {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	key := name
+	for _, n := range names {
+		key += " " + n + "=" + argValues[n]
+	}
+
+	if len(passthrough) > 0 {
+		key += " --"
+		for _, a := range passthrough {
+			// quote arguments that would be ambiguous when joined
+			if a == "" || strings.ContainsAny(a, " \t\n\"") {
+				a = strconv.Quote(a)
+			}
+			key += " " + a
+		}
+	}
+
+	return key
+}
+
+// check if the node is one of the invocations requested by the user
+func (dg *depGraph) isRoot(n *depNode) bool {
+	for _, r := range dg.roots {
+		if r == n {
+			return true
+		}
+	}
+	return false
+}
+
+// result of a node execution
+type nodeResult struct {
+	node *depNode
+	err  error
+}
+
+// execute the graph.
+// a node is started once all of its dependencies finished successfully,
+// independent nodes are executed in parallel, up to the maxParallel limit.
+// if a command fails and stopOnError is set for it, no further nodes will be started.
+// nodes that depend on a failed node are never started.
+// returns the first error that occurred.
+func (dg *depGraph) exec() error {
+
+	var (
+		limit    = maxParallel()
+		results  = make(chan nodeResult)
+		pending  = make(map[*depNode]int)
+		started  = make(map[*depNode]bool)
+		running  int
+		stop     bool
+		firstErr error
+		start    = time.Now()
+		records  = make(map[*depNode]*commandRecord)
+	)
+
+	// count unfinished dependencies for each node
+	for _, n := range dg.nodes {
+		pending[n] = len(n.deps)
+
+		// nodes that are never started remain cancelled
+		records[n] = &commandRecord{
+			Command: n.cmd.name,
+			Args:    maskSecretArgs(n.argValues),
+			Status:  statusCancelled,
+		}
+	}
+
+	// every node is executed at most once
+	s.Lock()
+	s.numCommands += len(dg.nodes)
+	s.Unlock()
+
+	for {
+
+		// start ready nodes in topological order
+		if !stop {
+			for _, n := range dg.nodes {
+				if running >= limit {
+					break
+				}
+				if started[n] || pending[n] > 0 {
+					continue
+				}
+
+				started[n] = true
+				running++
+
+				go func(n *depNode, rec *commandRecord) {
+					results <- nodeResult{
+						node: n,
+						err:  n.cmd.AtomicRun(n.argBuffer, n.argValues, n.rawArgs, false, rec),
+					}
+				}(n, records[n])
+			}
+		}
+
+		// nothing left that could be executed
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+
+		if res.err != nil {
+			Log.WithError(res.err).Error("failed to execute " + res.node.cmd.name)
+
+			if firstErr == nil {
+				if dg.isRoot(res.node) {
+					firstErr = res.err
+				} else {
+					firstErr = errors.New("dependency error: " + res.err.Error())
+				}
+			}
+
+			if res.node.cmd.shouldStopOnError() {
+				stop = true
+			}
+
+			// dependents of the failed node keep a pending count > 0 and will never be started
+			continue
+		}
+
+		// notify dependents
+		for _, n := range dg.nodes {
+			for _, d := range n.deps {
+				if d == res.node {
+					pending[n]--
+				}
+			}
+		}
+	}
+
+	dg.record(start, records, firstErr)
+
+	return firstErr
+}
+
+// add the execution of the graph to the run history
+func (dg *depGraph) record(start time.Time, records map[*depNode]*commandRecord, err error) {
+
+	var invocation []string
+	for _, r := range dg.roots {
+		invocation = append(invocation, r.label)
+	}
+
+	projectData.Lock()
+	buildNumber := projectData.fields.BuildNumber
+	projectData.Unlock()
+
+	run := &runRecord{
+		Start:       start,
+		Invocation:  strings.Join(invocation, " "+commandChainSeparator+" "),
+		DurationMS:  durationMS(time.Since(start)),
+		Success:     err == nil,
+		BuildNumber: buildNumber,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	for _, n := range dg.nodes {
+		run.Commands = append(run.Commands, records[n])
+	}
+
+	if err := recordRun(run); err != nil {
+		Log.WithError(err).Error("failed to record run")
+	}
+}
+
+// number of commands that may be executed at the same time
+// the -j commandline flag takes precedence over the maxParallel config field
+func maxParallel() int {
+
+	if parallelFlag > 0 {
+		return parallelFlag
+	}
+
+	conf.Lock()
+	defer conf.Unlock()
+
+	if conf.fields.MaxParallel < 1 {
+		return 1
+	}
+	return conf.fields.MaxParallel
+}
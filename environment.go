@@ -0,0 +1,249 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// environment modes
+const (
+	// pass the environment of zeus to the command
+	envInherit = "inherit"
+
+	// only pass the variables on the allowlist
+	envClean = "clean"
+)
+
+// envData is the env section of the commandsFile or a command.
+// the section of a command overwrites the mode and globalsPrefix of the commandsFile,
+// allowlists, files and vars are combined
+type envData struct {
+
+	// inherit or clean, defaults to inherit
+	Mode string `yaml:"mode"`
+
+	// variables passed to the command in clean mode, supports patterns like LC_*
+	Allow []string `yaml:"allow"`
+
+	// .env files loaded for the command
+	Files []string `yaml:"files"`
+
+	// explicit variables
+	Vars map[string]string `yaml:"vars"`
+
+	// prefix for the globals passed via the environment
+	GlobalsPrefix string `yaml:"globalsPrefix"`
+}
+
+// validate the env section, name is used for the error messages
+func (d *envData) validate(name string) error {
+
+	switch d.Mode {
+	case "", envInherit, envClean:
+	default:
+		return errors.New("invalid env mode " + name + ": " + d.Mode + ", expected inherit or clean")
+	}
+
+	for _, p := range d.Allow {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.New("invalid env allow pattern " + name + ": " + p)
+		}
+	}
+
+	return nil
+}
+
+// combine the env section of the commandsFile with the one of a command
+func mergeEnv(project, cmd *envData) *envData {
+
+	merged := &envData{
+		Mode: envInherit,
+		Vars: make(map[string]string),
+	}
+
+	for _, d := range []*envData{project, cmd} {
+		if d == nil {
+			continue
+		}
+		if d.Mode != "" {
+			merged.Mode = d.Mode
+		}
+		if d.GlobalsPrefix != "" {
+			merged.GlobalsPrefix = d.GlobalsPrefix
+		}
+		merged.Allow = append(merged.Allow, d.Allow...)
+		merged.Files = append(merged.Files, d.Files...)
+		for k, v := range d.Vars {
+			merged.Vars[k] = v
+		}
+	}
+
+	return merged
+}
+
+// assemble the environment for a command.
+// variables are applied in order: host environment, globals, files and vars
+func (d *envData) environ(globals map[string]string) ([]string, error) {
+
+	var env []string
+
+	for _, kv := range os.Environ() {
+		if d.Mode == envClean && !d.allowed(strings.SplitN(kv, "=", 2)[0]) {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	for _, name := range sortedKeys(globals) {
+		env = setEnv(env, d.GlobalsPrefix+name, globals[name])
+	}
+
+	for _, f := range d.Files {
+		vars, err := loadEnvFile(f)
+		if err != nil {
+			return nil, errors.New("failed to load env file " + f + ": " + err.Error())
+		}
+		for _, kv := range vars {
+			env = setEnv(env, kv[0], kv[1])
+		}
+	}
+
+	for _, name := range sortedKeys(d.Vars) {
+		env = setEnv(env, name, resolveEnvironment(d.Vars[name]))
+	}
+
+	return env, nil
+}
+
+// check if a variable is on the allowlist
+func (d *envData) allowed(name string) bool {
+	for _, p := range d.Allow {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// description of the env section for the dump and explain output
+func (d *envData) String() string {
+
+	desc := d.Mode
+	if len(d.Allow) > 0 {
+		desc += ", allow " + strings.Join(d.Allow, " ")
+	}
+	if len(d.Files) > 0 {
+		desc += ", files " + strings.Join(d.Files, " ")
+	}
+	if len(d.Vars) > 0 {
+		desc += ", " + strconv.Itoa(len(d.Vars)) + " vars"
+	}
+	if d.GlobalsPrefix != "" {
+		desc += ", globals prefix " + d.GlobalsPrefix
+	}
+
+	return desc
+}
+
+// keys of a map in sorted order, for a deterministic environment
+func sortedKeys(m map[string]string) []string {
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// set a variable, replacing a previous value
+func setEnv(env []string, name, value string) []string {
+
+	prefix := name + "="
+	for i, kv := range env {
+		if strings.HasPrefix(kv, prefix) {
+			env[i] = prefix + value
+			return env
+		}
+	}
+
+	return append(env, prefix+value)
+}
+
+// load the variables from a .env file.
+// supports comments, export statements and quoted values
+func loadEnvFile(file string) (vars [][2]string, err error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		scanner = bufio.NewScanner(f)
+		lineNum int
+	)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, errors.New("invalid line " + strconv.Itoa(lineNum) + ": " + line)
+		}
+
+		var (
+			name  = strings.TrimSpace(line[:i])
+			value = strings.TrimSpace(line[i+1:])
+		)
+
+		switch {
+		case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, errors.New("invalid value in line " + strconv.Itoa(lineNum) + ": " + err.Error())
+			}
+		case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// strip trailing comments from unquoted values
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = strings.TrimSpace(value[:j])
+			}
+		}
+
+		vars = append(vars, [2]string{name, value})
+	}
+
+	return vars, scanner.Err()
+}
@@ -158,7 +158,7 @@ func registerEvent(args []string) {
 			Log.Debug("event fired, name: ", event.Name, " path: ", args[3])
 
 			if cmdChain, ok := validCommandChain(fields, true); ok {
-				cmdChain.exec(fields)
+				cmdChain.exec(fields, nil)
 			} else {
 
 				// its a shell command
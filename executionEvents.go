@@ -0,0 +1,185 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// types of execution events
+const (
+	eventStart  = "start"
+	eventFinish = "finish"
+	eventSkip   = "skip"
+	eventFail   = "fail"
+)
+
+// number of stderr lines included in fail events
+const stderrTailLines = 20
+
+var (
+	// serializes writing events to stdout and the event stream
+	executionEventMutex = &sync.Mutex{}
+
+	// log format set via the --log-format flag
+	// overrides the logFormat config field if set
+	logFormatFlag string
+)
+
+// executionEvent describes a change in the lifecycle of a command execution
+// events are emitted as a single line of JSON
+type executionEvent struct {
+	Time       time.Time         `json:"time"`
+	Type       string            `json:"type"`
+	Command    string            `json:"command"`
+	Args       map[string]string `json:"args,omitempty"`
+	Step       int               `json:"step,omitempty"`
+	Total      int               `json:"total,omitempty"`
+	PID        int               `json:"pid,omitempty"`
+	Async      bool              `json:"async,omitempty"`
+	Attempt    int               `json:"attempt,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+	Restarts   int               `json:"restarts,omitempty"`
+	DurationMS float64           `json:"durationMs,omitempty"`
+	ExitCode   *int              `json:"exitCode,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Stderr     string            `json:"stderr,omitempty"`
+	Resources  *resourceUsage    `json:"resources,omitempty"`
+
+	// record of the run history that is updated with the event
+	record *commandRecord
+}
+
+// formats for the output of the command lifecycle
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// check if the log format is supported
+// an empty format falls back to text
+func validateLogFormat(format string) error {
+	switch format {
+	case "", logFormatText, logFormatJSON:
+		return nil
+	}
+	return errors.New("invalid log format: " + format + ", expected text or json")
+}
+
+// check if the lifecycle of commands shall be printed as JSON instead of colored text
+func jsonLogFormat() bool {
+
+	if logFormatFlag != "" {
+		return logFormatFlag == logFormatJSON
+	}
+
+	conf.Lock()
+	defer conf.Unlock()
+
+	return conf.fields.LogFormat == logFormatJSON
+}
+
+// emit an execution event
+// the record of the run history is updated with every event,
+// events are printed to stdout when the JSON log format is used,
+// and appended to the event stream file if one is configured
+func emitEvent(e *executionEvent) {
+
+	// events are persisted in the run history and the event stream
+	e.Args = maskSecretArgs(e.Args)
+	e.Error = maskSecrets(e.Error)
+	e.Stderr = maskSecrets(e.Stderr)
+
+	e.record.update(e)
+
+	conf.Lock()
+	path := conf.fields.EventStream
+	conf.Unlock()
+
+	jsonFormat := jsonLogFormat()
+
+	if path == "" && !jsonFormat {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		Log.WithError(err).Error("failed to marshal execution event")
+		return
+	}
+	b = append(b, '\n')
+
+	executionEventMutex.Lock()
+	defer executionEventMutex.Unlock()
+
+	if jsonFormat {
+		os.Stdout.Write(b)
+	}
+
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			Log.WithError(err).Error("failed to open event stream")
+			return
+		}
+		defer f.Close()
+
+		_, err = f.Write(b)
+		if err != nil {
+			Log.WithError(err).Error("failed to write event stream")
+		}
+	}
+}
+
+// get the exit code for an error returned from exec.Cmd.Wait
+// returns nil if the error does not contain an exit code
+func exitCode(err error) *int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := exitErr.ExitCode()
+		return &code
+	}
+	return nil
+}
+
+// convert a duration to milliseconds
+func durationMS(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// return the last lines of the captured stderr output
+func tail(output string, lines int) string {
+
+	parts := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(parts) > lines {
+		parts = parts[len(parts)-lines:]
+	}
+
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,142 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+func printExplainCommandUsageErr() {
+	l.Println("invalid usage")
+	l.Println("usage: explain <command|chain>")
+}
+
+// handle the explain builtin
+func handleExplainCommand(args []string) {
+
+	if len(args) < 2 {
+		printExplainCommandUsageErr()
+		return
+	}
+
+	err := explain(strings.Join(args[1:], " "))
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// print the execution plan for a command or commandChain without executing anything.
+// for each step the decision whether it will be executed or skipped is shown,
+// together with the interpreter commandline and the fully assembled script.
+func explain(line string) error {
+
+	dg, err := resolveGraph(line)
+	if err != nil {
+		return err
+	}
+
+	w := 16
+
+	for i, n := range dg.nodes {
+
+		upToDate, _, reason, err := n.cmd.upToDate(n.argValues, n.passthrough)
+		if err != nil {
+			return err
+		}
+
+		workDir, err := replaceArgs(n.cmd.workingDir, n.cmd.joinArgs(n.argValues))
+		if err != nil {
+			return err
+		}
+
+		step := "[" + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(dg.nodes)) + "] "
+		if upToDate {
+			l.Println(printPrompt() + step + "skip " + cp.Prompt + n.label + cp.Reset)
+			l.Println(cp.Text + pad("   reason", w) + "all named outputs are up to date")
+		} else {
+			l.Println(printPrompt() + step + "run " + cp.Prompt + n.label + cp.Reset)
+			l.Println(cp.Text + pad("   reason", w) + reason)
+		}
+
+		if len(n.deps) > 0 {
+			var deps []string
+			for _, d := range n.deps {
+				deps = append(deps, d.label)
+			}
+			l.Println(pad("   after", w) + strings.Join(deps, ", "))
+		}
+
+		if workDir == "" {
+			workDir, _ = os.Getwd()
+		}
+		l.Println(pad("   workingDir", w) + workDir)
+
+		if len(n.cmd.outputs) > 0 {
+			outputs, err := n.cmd.expandAll(n.cmd.outputs, n.argValues)
+			if err != nil {
+				return err
+			}
+			l.Println(pad("   outputs", w) + strings.Join(outputs, ", "))
+		}
+
+		if n.cmd.async {
+			l.Println(pad("   async", w) + "true")
+		}
+		if n.cmd.timeout > 0 {
+			l.Println(pad("   timeout", w) + n.cmd.timeout.String())
+		}
+		if n.cmd.limits != nil {
+			l.Println(pad("   limits", w) + n.cmd.limits.String())
+		}
+		if n.cmd.sandbox != nil {
+			l.Println(pad("   sandbox", w) + n.cmd.sandbox.String())
+		}
+		if n.cmd.env != nil || n.cmd.projectEnv != nil {
+			l.Println(pad("   env", w) + n.cmd.environment().String())
+		}
+		if lang, err := n.cmd.getLanguage(); err == nil && len(n.cmd.args) > 0 {
+			l.Println(pad("   argMode", w) + n.cmd.argumentMode(lang))
+		}
+		if n.cmd.retries > 0 {
+			l.Println(pad("   retries", w) + strconv.Itoa(n.cmd.retries) + " (delay " + n.cmd.retryDelay.String() + ")")
+		}
+
+		// assemble the commandline in the same way as for the execution, without touching the filesystem
+		cl, err := n.cmd.commandline(n.argValues, n.argBuffer, n.rawArgs, workDir)
+		if err != nil {
+			return err
+		}
+
+		// the script is printed separately
+		argv := append([]string(nil), cl.argv...)
+		if cl.scriptIndex >= 0 {
+			argv[cl.scriptIndex] = "<script>"
+		}
+		l.Println(pad("   argv", w) + maskSecrets(strings.Join(argv, " ")))
+
+		if cl.script != "" {
+			printScript(cl.script, n.cmd.name, -1)
+		}
+		l.Println()
+	}
+
+	return nil
+}
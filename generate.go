@@ -153,6 +153,12 @@ func generateScript(outputName string, mixed bool, cmd *command, args []string)
 		}
 	}
 
+	// computed globals are written with their current value
+	err = g.refresh()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if mixed {
 		// create new file in output directory
 		outputName = outputName + "/" + cmd.name + lang.FileExtension
@@ -167,7 +173,7 @@ func generateScript(outputName string, mixed bool, cmd *command, args []string)
 	header += lang.Comment + " Timestamp: " + time.Now().Format(timestampFormat) + "\n"
 
 	// insert bang and args
-	f.WriteString(lang.Bang + "\n" + header + "\n" + generateGlobals(lang) + "\n" + arguments + "\n")
+	f.WriteString(lang.Bang + "\n" + header + "\n" + generateGlobals(lang, "") + "\n" + arguments + "\n")
 
 	// add language specific global code
 	code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
@@ -19,19 +19,471 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"math"
+	"os/exec"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// types for globals, named like the argument types
+const (
+	globalString = "String"
+	globalInt    = "Int"
+	globalBool   = "Bool"
+	globalFloat  = "Float"
+	globalList   = "List"
+	globalMap    = "Map"
+)
+
+// shapes of a value in the globals section
+const (
+	shapeScalar   = "scalar"
+	shapeList     = "list"
+	shapeMap      = "map"
+	shapeComputed = "computed"
+)
+
+// names of globals must be valid identifiers in all languages
+var globalNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type globals struct {
 
 	// mapped variable names to values
+	// lists and maps are stored as JSON
 	Vars map[string]string
 
+	// mapped variable names to typed values
+	Values map[string]*globalVar
+
 	sync.RWMutex
 }
 
+func newGlobals() *globals {
+	return &globals{
+		Vars:   make(map[string]string, 0),
+		Values: make(map[string]*globalVar, 0),
+	}
+}
+
+// evaluate all computed globals that have not been evaluated yet or whose ttl expired
+func (gs *globals) refresh() error {
+
+	gs.Lock()
+	defer gs.Unlock()
+
+	for _, name := range sortedKeys(gs.Vars) {
+		if err := gs.evaluate(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copy the globals, so they can be used without holding the lock
+// while computed globals are evaluated by parallel commands
+func (gs *globals) snapshot() (vars map[string]string, values map[string]*globalVar) {
+
+	gs.Lock()
+	defer gs.Unlock()
+
+	vars = make(map[string]string, len(gs.Vars))
+	for name, v := range gs.Vars {
+		vars[name] = v
+	}
+
+	values = make(map[string]*globalVar, len(gs.Values))
+	for name, gl := range gs.Values {
+		c := *gl
+		values[name] = &c
+	}
+
+	return vars, values
+}
+
+// get the value of a global, computed globals are evaluated if needed
+func (gs *globals) get(name string) (value string, ok bool, err error) {
+
+	gs.Lock()
+	defer gs.Unlock()
+
+	if _, ok := gs.Vars[name]; !ok {
+		return "", false, nil
+	}
+	if err := gs.evaluate(name); err != nil {
+		return "", true, err
+	}
+
+	return gs.Vars[name], true, nil
+}
+
+// evaluate a computed global if it is stale, the caller must hold the lock
+func (gs *globals) evaluate(name string) error {
+
+	gl, ok := gs.Values[name]
+	if !ok || !gl.stale() {
+		return nil
+	}
+
+	if err := gl.evaluate(); err != nil {
+		return err
+	}
+	gs.Vars[name] = gl.String()
+
+	return nil
+}
+
+// globalValue is a value from the globals section of the commandsFile.
+// scalars are kept as they were written, lists and maps can only contain scalars.
+// values written as $(command) or maps with a shell key are computed
+type globalValue struct {
+	shape  string
+	scalar string
+	list   []string
+	dict   map[string]string
+
+	// shell command and ttl of computed globals
+	shell string
+	ttl   string
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (v *globalValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	if err := unmarshal(&v.scalar); err == nil {
+		v.shape = shapeScalar
+		if s := strings.TrimSpace(v.scalar); strings.HasPrefix(s, "$(") && strings.HasSuffix(s, ")") {
+			v.shape = shapeComputed
+			v.shell = s[2 : len(s)-1]
+		}
+		return nil
+	}
+	if err := unmarshal(&v.list); err == nil {
+		v.shape = shapeList
+		return nil
+	}
+	if err := unmarshal(&v.dict); err == nil {
+		v.shape = shapeMap
+		_, hasTTL := v.dict["ttl"]
+		if shell, ok := v.dict["shell"]; ok && (len(v.dict) == 1 || hasTTL && len(v.dict) == 2) {
+			v.shape = shapeComputed
+			v.shell = shell
+			v.ttl = v.dict["ttl"]
+		}
+		return nil
+	}
+
+	return errors.New("globals must be scalars, lists of scalars or maps of scalars")
+}
+
+// globalVar is a validated global variable
+type globalVar struct {
+	name  string
+	typ   string
+	value string
+	list  []string
+	dict  map[string]string
+
+	// type from the declaration, empty if the type is inferred from the value
+	declared string
+
+	// shell command of a computed global
+	shell string
+
+	// computed globals with a ttl are evaluated lazily and evaluated again once it expired
+	ttl time.Duration
+
+	// time of the last evaluation, zero if the global has not been evaluated yet
+	evaluated time.Time
+
+	// commandsFile and line of the declaration, for error messages
+	source string
+}
+
+// parse an entry of the globals section
+// the key can declare a type, like arguments: name:Type
+// untyped integers and booleans keep their type, other scalars are strings.
+// computed globals are not evaluated yet
+func parseGlobal(key string, v *globalValue) (*globalVar, error) {
+
+	// a global without a value is an empty string
+	if v == nil {
+		v = &globalValue{shape: shapeScalar}
+	}
+
+	var (
+		slice = strings.Split(key, ":")
+		gl    = &globalVar{
+			name: strings.TrimSpace(slice[0]),
+		}
+	)
+
+	if len(slice) > 2 {
+		return nil, errors.New("invalid global " + key + ": expected name:Type")
+	}
+	if len(slice) == 2 {
+		gl.declared = strings.TrimSpace(slice[1])
+	}
+	if !globalNameRegex.MatchString(gl.name) {
+		return nil, errors.New("invalid global name: " + gl.name)
+	}
+
+	switch gl.declared {
+	case "", globalString, globalInt, globalBool, globalFloat, globalList, globalMap:
+	default:
+		return nil, errors.New("unknown type for global " + key + ", expected one of: String, Int, Bool, Float, List, Map")
+	}
+
+	// a map with a shell key is only a computed global if no other type was declared
+	if v.shape == shapeComputed && gl.declared == globalMap && v.dict != nil {
+		v.shape = shapeMap
+	}
+
+	// resolve environment variables and secrets used in the values
+	// must be in format ${VAR} or ${secret:name}
+	resolve := func(value string) (string, error) {
+		value, err := resolveSecrets(resolveEnvironment(value))
+		if err != nil {
+			return "", errors.New("invalid global " + key + ": " + err.Error())
+		}
+		return value, nil
+	}
+
+	var err error
+	switch v.shape {
+	case shapeComputed:
+		if gl.declared == globalList || gl.declared == globalMap {
+			return nil, errors.New("invalid global " + key + ": computed globals must be scalars")
+		}
+		gl.shell = strings.TrimSpace(v.shell)
+		if gl.shell == "" {
+			return nil, errors.New("invalid global " + key + ": empty shell command")
+		}
+		if v.ttl != "" {
+			gl.ttl, err = time.ParseDuration(v.ttl)
+			if err != nil || gl.ttl <= 0 {
+				return nil, errors.New("invalid ttl for global " + key + ": " + v.ttl)
+			}
+		}
+		gl.typ = gl.declared
+		if gl.typ == "" {
+			gl.typ = globalString
+		}
+		return gl, nil
+	case shapeScalar:
+		value, err := resolve(v.scalar)
+		if err != nil {
+			return nil, err
+		}
+		err = gl.setScalar(value)
+		if err != nil {
+			return nil, errors.New("invalid value for global " + key + ": " + err.Error())
+		}
+	case shapeList:
+		gl.list = make([]string, len(v.list))
+		for i, e := range v.list {
+			gl.list[i], err = resolve(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case shapeMap:
+		gl.dict = make(map[string]string, len(v.dict))
+		for k, e := range v.dict {
+			gl.dict[k], err = resolve(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// lists and maps can not be declared with a scalar type
+	switch v.shape {
+	case shapeList:
+		gl.typ = globalList
+	case shapeMap:
+		gl.typ = globalMap
+	}
+	if gl.declared != "" && gl.typ != gl.declared {
+		return nil, errors.New("invalid value for global " + key + ": expected a " + shapeOf(gl.declared))
+	}
+
+	return gl, nil
+}
+
+// set the value of a scalar global
+// the value is validated and normalized for the declared type or the type is inferred
+func (gl *globalVar) setScalar(value string) error {
+
+	gl.typ = gl.declared
+	if gl.typ == "" {
+		gl.typ = inferGlobalType(value)
+	}
+
+	switch gl.typ {
+	case globalString:
+	case globalInt:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("expected an Int, got: " + value)
+		}
+		value = strconv.FormatInt(i, 10)
+	case globalBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected a Bool, got: " + value)
+		}
+		value = strconv.FormatBool(b)
+	case globalFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return errors.New("expected a Float, got: " + value)
+		}
+		// keep the decimal point, so the value is not treated as an integer
+		value = strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(value, ".e") {
+			value += ".0"
+		}
+	default:
+		return errors.New("expected a " + shapeOf(gl.typ))
+	}
+
+	gl.value = value
+	return nil
+}
+
+// check if a computed global needs to be evaluated
+func (gl *globalVar) stale() bool {
+	if gl.shell == "" {
+		return false
+	}
+	if gl.evaluated.IsZero() {
+		return true
+	}
+	return gl.ttl > 0 && time.Since(gl.evaluated) > gl.ttl
+}
+
+// evaluate the shell command of a computed global in the project root
+// trailing newlines are removed from the output
+func (gl *globalVar) evaluate() error {
+
+	var (
+		cmd    = exec.Command("/bin/sh", "-c", gl.shell)
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		msg := err.Error()
+		if out := strings.TrimSpace(stderr.String()); out != "" {
+			msg += ": " + out
+		}
+		return errors.New(gl.source + "global " + gl.name + ": $(" + gl.shell + ") failed: " + msg)
+	}
+
+	err = gl.setScalar(strings.TrimRight(stdout.String(), "\r\n"))
+	if err != nil {
+		return errors.New(gl.source + "global " + gl.name + ": invalid output of $(" + gl.shell + "): " + err.Error())
+	}
+	gl.evaluated = time.Now()
+
+	return nil
+}
+
+// shape of the values of a type
+func shapeOf(typ string) string {
+	switch typ {
+	case globalList:
+		return shapeList
+	case globalMap:
+		return shapeMap
+	}
+	return shapeScalar
+}
+
+// infer the type of an untyped scalar
+func inferGlobalType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return globalInt
+	}
+	// single characters like t or f are not treated as booleans
+	if _, err := strconv.ParseBool(value); err == nil && len(value) > 1 {
+		return globalBool
+	}
+	return globalString
+}
+
+// the value as passed via the environment and used for ${} replacements
+func (gl *globalVar) String() string {
+
+	switch gl.typ {
+	case globalList, globalMap:
+		b, err := json.Marshal(gl.typed())
+		if err != nil {
+			Log.WithError(err).Error("failed to encode global " + gl.name)
+		}
+		return string(b)
+	}
+
+	return gl.value
+}
+
+// typed value of the global, for JSON encoding
+func (gl *globalVar) typed() interface{} {
+
+	switch gl.typ {
+	case globalList:
+		list := make([]interface{}, len(gl.list))
+		for i, e := range gl.list {
+			list[i] = typedValue(e)
+		}
+		return list
+	case globalMap:
+		dict := make(map[string]interface{}, len(gl.dict))
+		for k, e := range gl.dict {
+			dict[k] = typedValue(e)
+		}
+		return dict
+	case globalInt:
+		if i, err := strconv.ParseInt(gl.value, 10, 64); err == nil {
+			return i
+		}
+	case globalFloat:
+		if f, err := strconv.ParseFloat(gl.value, 64); err == nil {
+			return f
+		}
+	case globalBool:
+		if b, err := strconv.ParseBool(gl.value); err == nil {
+			return b
+		}
+	}
+
+	return gl.value
+}
+
+// typed value of an element of a list or map, for JSON encoding
+func typedValue(value string) interface{} {
+	switch inferGlobalType(value) {
+	case globalInt:
+		i, _ := strconv.ParseInt(value, 10, 64)
+		return i
+	case globalBool:
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return value
+}
+
 // print the contents of all globals on stdout
 func listGlobals() {
 
@@ -42,9 +494,27 @@ func listGlobals() {
 
 		w := 20
 
-		l.Println("\n" + cp.Prompt + pad("name", w) + "value")
-		for name, val := range g.Vars {
-			l.Println(cp.Text+pad(name, w), val)
+		l.Println("\n" + cp.Prompt + pad("name", w) + pad("type", 10) + "value")
+		for _, name := range sortedKeys(g.Vars) {
+			typ := globalString
+			gl, ok := g.Values[name]
+			if ok {
+				typ = gl.typ
+			}
+			if err := g.evaluate(name); err != nil {
+				l.Println(cp.Text+pad(name, w)+pad(typ, 10), err)
+				continue
+			}
+			value := maskSecrets(g.Vars[name])
+
+			// show where computed values come from
+			if ok && gl.shell != "" {
+				value += cp.Prompt + " $(" + gl.shell + ")"
+				if gl.ttl > 0 {
+					value += ", ttl " + gl.ttl.String()
+				}
+			}
+			l.Println(cp.Text+pad(name, w)+pad(typ, 10), value)
 		}
 
 		ls.Lock()
@@ -61,33 +531,36 @@ func listGlobals() {
 	}
 }
 
+// declare the globals referenced in the code of a command as variables of the language,
+// followed by the language specific global code.
+// unused globals are left out, so they do not shift the line numbers of errors in the command
+func globalCode(lang *Language, code string) string {
+
+	globals, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
+	if err != nil {
+		return generateGlobals(lang, code)
+	}
+
+	return generateGlobals(lang, code+"\n"+string(globals)) + string(globals)
+}
+
 // generate global variables for a given language
+// if code is not empty, only the globals referenced in the code are declared
 // returns a string
-func generateGlobals(lang *Language) (out string) {
+func generateGlobals(lang *Language, code string) (out string) {
 
-	g.Lock()
-	defer g.Unlock()
-
-	// initialize global variables
-	for name, value := range g.Vars {
+	vars, values := g.snapshot()
 
-		var valString = true
-		// check if its a boolean
-		if _, err := strconv.ParseBool(value); err == nil {
-			// value goot as it is
-			valString = false
+	// sorted, so the generated code does not change between runs
+	for _, name := range sortedKeys(vars) {
+		if code != "" && !regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\b`).MatchString(code) {
+			continue
 		}
-		// check if its an integer
-		if _, err := strconv.ParseInt(value, 10, 0); err == nil {
-			// value good as it is
-			valString = false
+		gl, ok := values[name]
+		if !ok {
+			gl = &globalVar{name: name, typ: globalString, value: vars[name]}
 		}
-		// check if its a string
-		if valString {
-			value = "\"" + value + "\""
-		}
-
-		out += lang.VariableKeyword + name + lang.AssignmentOperator + value + lang.LineDelimiter + "\n"
+		out += lang.declareGlobal(gl) + "\n"
 	}
 
 	return
@@ -0,0 +1,268 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// output formats for the graph builtin
+var graphFormats = []string{"ascii", "dot", "mermaid", "json"}
+
+// graphNode contains the information about a node of the dependency graph
+// that is presented to the user
+type graphNode struct {
+	ID           string            `json:"id"`
+	Command      string            `json:"command"`
+	Args         map[string]string `json:"args"`
+	Passthrough  []string          `json:"passthrough,omitempty"`
+	Language     string            `json:"language"`
+	Outputs      []string          `json:"outputs"`
+	Async        bool              `json:"async"`
+	Skip         bool              `json:"skip"`
+	Reason       string            `json:"reason,omitempty"`
+	Dependencies []string          `json:"dependencies"`
+}
+
+func printGraphCommandUsageErr() {
+	l.Println("invalid usage")
+	l.Println("usage: graph [ascii|dot|mermaid|json] <command|chain>")
+}
+
+// handle the graph builtin
+// resolves the dependency graph for a command or commandChain and prints it in the requested format
+func handleGraphCommand(args []string) {
+
+	if len(args) < 2 {
+		printGraphCommandUsageErr()
+		return
+	}
+
+	format := "ascii"
+	for _, f := range graphFormats {
+		if args[1] == f {
+			format = f
+			args = args[1:]
+			break
+		}
+	}
+
+	if len(args) < 2 {
+		printGraphCommandUsageErr()
+		return
+	}
+
+	dg, err := resolveGraph(strings.Join(args[1:], " "))
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	err = dg.write(l.Writer(), format)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// resolve the dependency graph for a command or commandChain
+// in the same way it would be resolved when executing it
+func resolveGraph(line string) (*depGraph, error) {
+
+	fields := strings.Split(line, commandChainSeparator)
+
+	cmdChain, ok := validCommandChain(fields, false)
+	if !ok {
+		return nil, errors.New("invalid command or commandChain: " + line)
+	}
+
+	return cmdChain.graph(fields, shellPrompt())
+}
+
+// collect the information that is presented to the user for all nodes of the graph
+func (dg *depGraph) describe() []*graphNode {
+
+	var nodes []*graphNode
+
+	for _, n := range dg.nodes {
+
+		gn := &graphNode{
+			ID:           dg.nodeID(n),
+			Command:      n.cmd.name,
+			Args:         maskSecretArgs(n.argValues),
+			Passthrough:  maskSecretList(n.passthrough),
+			Language:     n.cmd.language,
+			Async:        n.cmd.async,
+			Outputs:      []string{},
+			Dependencies: []string{},
+		}
+
+		for _, o := range n.cmd.outputs {
+			if out, err := n.cmd.expandArgs(o, n.argValues); err == nil {
+				gn.Outputs = append(gn.Outputs, out...)
+			}
+		}
+
+		skip, _, reason, err := n.cmd.upToDate(n.argValues, n.passthrough)
+		if err != nil {
+			reason = err.Error()
+		}
+		gn.Skip = skip
+		gn.Reason = reason
+
+		for _, d := range n.deps {
+			gn.Dependencies = append(gn.Dependencies, dg.nodeID(d))
+		}
+
+		nodes = append(nodes, gn)
+	}
+
+	return nodes
+}
+
+// label for a node: the invocation and its annotations
+func (gn *graphNode) label() string {
+
+	var (
+		key         = invocationKey(gn.Command, gn.Args, gn.Passthrough)
+		annotations = []string{gn.Language}
+	)
+
+	if len(gn.Outputs) > 0 {
+		annotations = append(annotations, "outputs: "+strings.Join(gn.Outputs, ", "))
+	}
+	if gn.Async {
+		annotations = append(annotations, "async")
+	}
+	if gn.Skip {
+		annotations = append(annotations, "skip")
+	}
+
+	return key + " [" + strings.Join(annotations, ", ") + "]"
+}
+
+// write the graph in the given format
+func (dg *depGraph) write(w io.Writer, format string) error {
+
+	var (
+		nodes = dg.describe()
+		byID  = make(map[string]*graphNode)
+	)
+
+	for _, gn := range nodes {
+		byID[gn.ID] = gn
+	}
+
+	switch format {
+	case "ascii":
+
+		var (
+			printed   = make(map[string]bool)
+			printNode func(gn *graphNode, prefix string, last bool, root bool)
+		)
+
+		printNode = func(gn *graphNode, prefix string, last bool, root bool) {
+
+			var line, childPrefix string
+			switch {
+			case root:
+				line = gn.label()
+			case last:
+				line = prefix + "└── " + gn.label()
+				childPrefix = prefix + "    "
+			default:
+				line = prefix + "├── " + gn.label()
+				childPrefix = prefix + "│   "
+			}
+
+			// print the dependencies of shared nodes only once
+			if printed[gn.ID] && len(gn.Dependencies) > 0 {
+				io.WriteString(w, line+" (see above)\n")
+				return
+			}
+			printed[gn.ID] = true
+
+			io.WriteString(w, line+"\n")
+			for i, id := range gn.Dependencies {
+				printNode(byID[id], childPrefix, i == len(gn.Dependencies)-1, false)
+			}
+		}
+
+		for _, r := range dg.roots {
+			printNode(byID[dg.nodeID(r)], "", true, true)
+		}
+
+	case "dot":
+		io.WriteString(w, "digraph zeus {\n")
+		for _, gn := range nodes {
+			io.WriteString(w, "    "+gn.ID+" [label="+strconv.Quote(gn.label())+"];\n")
+		}
+		for _, gn := range nodes {
+			for _, id := range gn.Dependencies {
+				io.WriteString(w, "    "+gn.ID+" -> "+id+";\n")
+			}
+		}
+		io.WriteString(w, "}\n")
+
+	case "mermaid":
+		io.WriteString(w, "graph TD\n")
+		for _, gn := range nodes {
+			// mermaid does not support escaped quotes inside of labels
+			io.WriteString(w, "    "+gn.ID+"[\""+strings.Replace(gn.label(), "\"", "#quot;", -1)+"\"]\n")
+		}
+		for _, gn := range nodes {
+			for _, id := range gn.Dependencies {
+				io.WriteString(w, "    "+gn.ID+" --> "+id+"\n")
+			}
+		}
+
+	case "json":
+		var roots []string
+		for _, r := range dg.roots {
+			roots = append(roots, dg.nodeID(r))
+		}
+
+		b, err := json.MarshalIndent(map[string]interface{}{
+			"roots": roots,
+			"nodes": nodes,
+		}, "", "    ")
+		if err != nil {
+			return err
+		}
+		w.Write(append(b, '\n'))
+
+	default:
+		return errors.New("unknown graph format: " + format)
+	}
+
+	return nil
+}
+
+// identifier of a node, based on its position in the graph
+func (dg *depGraph) nodeID(n *depNode) string {
+	for i, node := range dg.nodes {
+		if node == n {
+			return "n" + strconv.Itoa(i)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,295 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// invocation keys mapped to the hash of the last successful run
+	// loaded lazily from disk
+	hashes      map[string]string
+	hashesMutex = &sync.Mutex{}
+)
+
+// check if the command invocation can be skipped.
+// thats the case when all named outputs exist
+// and the inputs, the script, the arguments including the passthrough arguments and the globals did not change since the last successful run.
+// returns the current hash of the invocation, so it can be stored once the command succeeded,
+// and a reason describing why the command must be executed.
+func (c *command) upToDate(argValues map[string]string, passthrough []string) (upToDate bool, hash string, reason string, err error) {
+
+	// commands without outputs are always executed
+	if len(c.outputs) == 0 {
+		return false, "", "no outputs declared", nil
+	}
+
+	hash, err = c.hash(argValues, passthrough)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	outputs, err := c.expandAll(c.outputs, argValues)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	// check if all named outputs exist
+	for _, out := range outputs {
+
+		Log.Debug("checking output ", out)
+
+		_, err = os.Stat(out)
+		if err != nil {
+			return false, hash, "output missing: " + out, nil
+		}
+	}
+
+	hashesMutex.Lock()
+	defer hashesMutex.Unlock()
+
+	if err := loadHashes(); err != nil {
+		return false, hash, "", err
+	}
+
+	last, ok := hashes[invocationKey(c.name, maskSecretArgs(argValues), maskSecretList(passthrough))]
+	if !ok {
+		return false, hash, "no previous successful run", nil
+	}
+	if last != hash {
+		return false, hash, "inputs changed since the last successful run", nil
+	}
+
+	return true, hash, "", nil
+}
+
+// calculate the hash for a command invocation
+// over the contents of the declared inputs, the script, the arguments and the globals
+func (c *command) hash(argValues map[string]string, passthrough []string) (string, error) {
+
+	h := sha256.New()
+
+	inputs, err := c.expandAll(c.inputs, argValues)
+	if err != nil {
+		return "", err
+	}
+
+	// inputs
+	for _, pattern := range inputs {
+
+		files, err := expandInput(pattern)
+		if err != nil {
+			return "", errors.New("invalid input " + pattern + ": " + err.Error())
+		}
+
+		io.WriteString(h, "input "+pattern+"\n")
+		for _, file := range files {
+			if err := hashFile(h, file); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// script
+	if c.exec != "" {
+		io.WriteString(h, "exec\n"+c.exec+"\n")
+	} else if err := hashFile(h, c.path); err != nil {
+		return "", err
+	}
+
+	// arguments
+	io.WriteString(h, "args "+invocationKey(c.name, argValues, passthrough)+"\n")
+
+	// globals
+	g.Lock()
+	var names []string
+	for name := range g.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		io.WriteString(h, "global "+name+"="+g.Vars[name]+"\n")
+	}
+	g.Unlock()
+
+	if lang, err := c.getLanguage(); err == nil {
+		code, err := ioutil.ReadFile(zeusDir + "/globals/globals" + lang.FileExtension)
+		if err == nil {
+			io.WriteString(h, "globals\n")
+			h.Write(code)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// write the name and contents of a file into the hash
+// missing files are part of the hash as well
+func hashFile(h io.Writer, path string) error {
+
+	io.WriteString(h, "file "+path+"\n")
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			io.WriteString(h, "missing\n")
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// resolve an input glob into a sorted list of files
+// directories are added recursively, ** matches any number of directories
+func expandInput(pattern string) (files []string, err error) {
+
+	var matches []string
+
+	if strings.Contains(pattern, "**") {
+
+		// split pattern into root directory and the pattern for the files below it
+		parts := strings.SplitN(pattern, "**", 2)
+		root := filepath.Clean(parts[0])
+		if parts[0] == "" {
+			root = "."
+		}
+		rest := strings.TrimPrefix(parts[1], "/")
+		if rest == "" {
+			rest = "*"
+		}
+		depth := len(strings.Split(rest, "/"))
+
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			// match the pattern against the trailing path elements
+			elems := strings.Split(filepath.ToSlash(path), "/")
+			if len(elems) < depth {
+				return nil
+			}
+			ok, err := filepath.Match(rest, strings.Join(elems[len(elems)-depth:], "/"))
+			if err != nil {
+				return err
+			}
+			if ok {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range matches {
+		err = filepath.Walk(m, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// read the stored hashes from disk, if not done yet
+// hashesMutex must be locked by the caller
+func loadHashes() error {
+
+	if hashes != nil {
+		return nil
+	}
+
+	hashes = make(map[string]string)
+
+	contents, err := ioutil.ReadFile(zeusDir + "/hashes.yml")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return yaml.Unmarshal(contents, &hashes)
+}
+
+// remember the hash of a successful command invocation
+// the hashes are stored in the zeus directory
+func recordHash(name string, argValues map[string]string, passthrough []string, hash string) error {
+
+	hashesMutex.Lock()
+	defer hashesMutex.Unlock()
+
+	if err := loadHashes(); err != nil {
+		return err
+	}
+
+	// secret values must not end up in the hashes file
+	// the hash itself still changes when a secret changes
+	hashes[invocationKey(name, maskSecretArgs(argValues), maskSecretList(passthrough))] = hash
+
+	b, err := yaml.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(zeusDir+"/hashes.yml", b, 0600); err != nil {
+		return err
+	}
+
+	// the file mode is not changed for existing files
+	return os.Chmod(zeusDir+"/hashes.yml", 0600)
+}
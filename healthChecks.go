@@ -0,0 +1,235 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// health states of a detached process
+const (
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+var (
+	// default interval between two health checks
+	defaultHealthCheckInterval = 10 * time.Second
+
+	// default number of consecutive failed checks before a process is considered unhealthy
+	defaultHealthCheckRetries = 3
+)
+
+// healthCheckData is the health check configuration in the commandsFile
+// exactly one of command, tcp or http must be set
+type healthCheckData struct {
+
+	// shell command, healthy if the exit status is zero
+	Command string `yaml:"command"`
+
+	// address in the form host:port, healthy if a connection can be established
+	TCP string `yaml:"tcp"`
+
+	// URL, healthy if a GET request returns a status code below 400
+	HTTP string `yaml:"http"`
+
+	// duration between two checks
+	Interval string `yaml:"interval"`
+
+	// number of consecutive failed checks before the process is considered unhealthy
+	Retries int `yaml:"retries"`
+}
+
+// healthCheck for a long-running detached command
+type healthCheck struct {
+	command  string
+	tcp      string
+	http     string
+	interval time.Duration
+	retries  int
+}
+
+// validate the health check configuration of a command
+func (d *healthCheckData) init(name string) (*healthCheck, error) {
+
+	var n int
+	for _, v := range []string{d.Command, d.TCP, d.HTTP} {
+		if v != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("invalid healthCheck for command " + name + ": exactly one of command, tcp or http must be set")
+	}
+
+	hc := &healthCheck{
+		command:  d.Command,
+		tcp:      d.TCP,
+		http:     d.HTTP,
+		interval: defaultHealthCheckInterval,
+		retries:  defaultHealthCheckRetries,
+	}
+
+	if d.Interval != "" {
+		interval, err := time.ParseDuration(d.Interval)
+		if err != nil {
+			return nil, errors.New("invalid healthCheck interval for command " + name + ": " + err.Error())
+		}
+		if interval <= 0 {
+			return nil, errors.New("invalid healthCheck interval for command " + name + ": must be positive")
+		}
+		hc.interval = interval
+	}
+
+	if d.Retries < 0 {
+		return nil, errors.New("invalid healthCheck retries for command " + name + ": must not be negative")
+	}
+	if d.Retries > 0 {
+		hc.retries = d.Retries
+	}
+
+	return hc, nil
+}
+
+// run the health check once
+// the check must complete within the interval
+func (hc *healthCheck) check(workDir string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), hc.interval)
+	defer cancel()
+
+	switch {
+	case hc.command != "":
+		cmd := exec.CommandContext(ctx, "sh", "-c", hc.command)
+		cmd.Dir = workDir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.New(err.Error() + ": " + tail(string(out), 1))
+		}
+	case hc.tcp != "":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hc.tcp)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case hc.http != "":
+		req, err := http.NewRequest(http.MethodGet, hc.http, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return errors.New("status " + strconv.Itoa(resp.StatusCode))
+		}
+	}
+
+	return nil
+}
+
+// periodically run the health check for a detached process
+// until the supervisor of the process has finished
+func (c *command) monitorHealth(p *Process, workDir string) {
+
+	var (
+		ticker   = time.NewTicker(c.healthCheck.interval)
+		failures int
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		processMapMutex.Lock()
+		exited := p.Exited
+		processMapMutex.Unlock()
+
+		// don't check while the process is waiting for a restart
+		if exited {
+			failures = 0
+			continue
+		}
+
+		err := c.healthCheck.check(workDir)
+
+		var unhealthy bool
+		processMapMutex.Lock()
+		if err != nil {
+			failures++
+			Log.WithError(err).Debug("health check failed for " + c.name + " (" + strconv.Itoa(failures) + "/" + strconv.Itoa(c.healthCheck.retries) + ")")
+			if failures >= c.healthCheck.retries {
+				unhealthy = p.Health != healthUnhealthy
+				p.Health = healthUnhealthy
+			}
+		} else {
+			failures = 0
+			p.Health = healthHealthy
+		}
+		processMapMutex.Unlock()
+
+		if unhealthy {
+			c.handleUnhealthy(p, err)
+		}
+	}
+}
+
+// report a process that became unhealthy and stop it,
+// so the supervisor restarts it according to the restart policy.
+// processes without a restart policy keep running
+func (c *command) handleUnhealthy(p *Process, err error) {
+
+	showNote(c.name+" is unhealthy", err.Error())
+
+	if c.restart == "" {
+		return
+	}
+
+	processMapMutex.Lock()
+	if p.Exited || p.Stopped {
+		processMapMutex.Unlock()
+		return
+	}
+	p.unhealthy = true
+	pid := p.PID
+	processMapMutex.Unlock()
+
+	if !jsonLogFormat() {
+		l.Println(cp.Text + "stopping unhealthy " + cp.Prompt + c.name + cp.Text + " (ID: " + string(p.ID) + ")" + cp.Reset)
+	}
+
+	_, err = terminateProcessGroup(pid)
+	if err != nil {
+		Log.WithError(err).Debug("failed to stop unhealthy process group: ", pid)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// status of a command inside a recorded run
+const (
+	statusFinished  = "finished"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+	statusRunning   = "running"
+	statusDetached  = "detached"
+	statusCancelled = "cancelled"
+)
+
+// serializes access to the run history
+var historyMutex = &sync.Mutex{}
+
+// runRecord describes a single invocation of a command or commandChain
+// the run history is stored as JSON lines in the zeus directory
+type runRecord struct {
+	Start       time.Time        `json:"start"`
+	Invocation  string           `json:"invocation"`
+	DurationMS  float64          `json:"durationMs"`
+	Success     bool             `json:"success"`
+	Error       string           `json:"error,omitempty"`
+	BuildNumber int              `json:"buildNumber"`
+	Commands    []*commandRecord `json:"commands"`
+}
+
+// commandRecord describes the execution of a single step of a run
+type commandRecord struct {
+	Command    string            `json:"command"`
+	Args       map[string]string `json:"args,omitempty"`
+	Status     string            `json:"status"`
+	DurationMS float64           `json:"durationMs,omitempty"`
+	ExitCode   *int              `json:"exitCode,omitempty"`
+	Resources  *resourceUsage    `json:"resources,omitempty"`
+}
+
+// path of the run history
+func historyPath() string {
+	return zeusDir + "/runs.jsonl"
+}
+
+// update the record from an execution event
+// a nil record is ignored
+func (rec *commandRecord) update(e *executionEvent) {
+
+	if rec == nil {
+		return
+	}
+
+	switch e.Type {
+	case eventStart:
+		if e.Async {
+			rec.Status = statusDetached
+		} else {
+			rec.Status = statusRunning
+		}
+	case eventFinish:
+		rec.Status = statusFinished
+	case eventFail:
+		rec.Status = statusFailed
+	case eventSkip:
+		rec.Status = statusSkipped
+	}
+
+	rec.DurationMS = e.DurationMS
+	rec.ExitCode = e.ExitCode
+	rec.Resources = e.Resources
+}
+
+// append a run to the history
+func recordRun(r *runRecord) error {
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	f, err := os.OpenFile(historyPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// load the last n runs from the history, oldest first
+// if n is smaller than 1, all runs are returned
+func loadRuns(n int) ([]*runRecord, error) {
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	f, err := os.Open(historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		runs    []*runRecord
+		scanner = bufio.NewScanner(f)
+	)
+
+	// records of large chains can exceed the default token size
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		r := new(runRecord)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			Log.WithError(err).Debug("skipping invalid run record")
+			continue
+		}
+		runs = append(runs, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(runs) > n {
+		runs = runs[len(runs)-n:]
+	}
+
+	return runs, nil
+}
@@ -61,6 +61,8 @@ func createRouter() *httprouter.Router {
 	r.HandlerFunc("GET", "/quit", quitHandler)
 	r.HandlerFunc("GET", "/wiki", wikiIndexHandler)
 	r.HandlerFunc("GET", "/wiki/docs/:doc", wikiDocsHandler)
+	r.HandlerFunc("GET", "/report", reportHandler)
+	r.HandlerFunc("GET", "/procs/logs", procsLogsHandler)
 	r.HandlerFunc("GET", "/glue/ws", glueWebSocketHandler)
 	r.HandlerFunc("POST", "/glue/ajax", glueAjaxHandler)
 
@@ -235,7 +237,7 @@ func startJSWatcher() {
 	)
 	cLog.Info("starting JS watcher")
 
-	err := cmd.Start()
+	_, err := startProcessGroup(cmd, false)
 	if err != nil {
 		cLog.WithError(err).Error("JavaScript watcher failed")
 		return
@@ -267,7 +269,7 @@ func startSassWatcher() {
 
 	cLog.Info("starting sass watcher")
 
-	err := cmd.Start()
+	_, err := startProcessGroup(cmd, false)
 	if err != nil {
 		cLog.WithError(err).Error("sass watcher failed")
 		return
@@ -107,6 +107,13 @@ type Language struct {
 
 	CorrectErrLineNumber bool   `yaml:"correctErrLineNumber"`
 	ErrLineNumberSymbol  string `yaml:"errLineNumberSymbol"`
+
+	// syntax for the literals of globals and arguments, defaults to the name
+	// one of bash, sh, zsh, python, javascript, ruby, lua, perl or go
+	Literals string `yaml:"literals"`
+
+	// how arguments are passed to the commands of the language: env, json or inject
+	ArgMode string `yaml:"argMode"`
 }
 
 func bashLanguage() *Language {
@@ -0,0 +1,199 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// get the syntax used for the literals of globals
+// defaults to the name of the language
+func (lang *Language) literalSyntax() string {
+	if lang.Literals != "" {
+		return lang.Literals
+	}
+	return lang.Name
+}
+
+// declaration of a global variable in the language
+func (lang *Language) declareGlobal(gl *globalVar) string {
+
+	syntax := lang.literalSyntax()
+
+	// associative arrays must be declared in shells
+	if gl.typ == globalMap {
+		switch syntax {
+		case "bash":
+			return "declare -A " + gl.name + "=" + mapLiteral(syntax, gl.dict)
+		case "zsh":
+			return "typeset -A " + gl.name + "; " + gl.name + "=" + mapLiteral(syntax, gl.dict)
+		}
+	}
+
+	return lang.VariableKeyword + gl.name + lang.AssignmentOperator + globalLiteral(syntax, gl) + lang.LineDelimiter
+}
+
+// literal for the value of a global
+func globalLiteral(syntax string, gl *globalVar) string {
+	switch gl.typ {
+	case globalList:
+		return listLiteral(syntax, "", gl.list)
+	case globalMap:
+		return mapLiteral(syntax, gl.dict)
+	}
+	return scalarLiteral(syntax, gl.typ, gl.value)
+}
+
+// literal for a scalar value of the given type
+func scalarLiteral(syntax, typ, value string) string {
+
+	switch typ {
+	case globalInt, globalFloat:
+		return value
+	case globalBool:
+		b, _ := strconv.ParseBool(value)
+		switch syntax {
+		case "python":
+			if b {
+				return "True"
+			}
+			return "False"
+		case "perl":
+			if b {
+				return "1"
+			}
+			return "0"
+		}
+		return strconv.FormatBool(b)
+	}
+
+	return quoteString(syntax, value)
+}
+
+// literal for a list of elements with the given type
+// the types of the elements are inferred if the type is empty
+func listLiteral(syntax, typ string, list []string) string {
+
+	elems := make([]string, len(list))
+	for i, e := range list {
+		if typ == "" {
+			elems[i] = scalarLiteral(syntax, inferGlobalType(e), e)
+		} else {
+			elems[i] = scalarLiteral(syntax, typ, e)
+		}
+	}
+
+	switch syntax {
+	case "bash", "zsh":
+		return "(" + strings.Join(elems, " ") + ")"
+	case "python", "javascript", "ruby", "perl":
+		return "[" + strings.Join(elems, ", ") + "]"
+	case "lua":
+		return "{" + strings.Join(elems, ", ") + "}"
+	case "go":
+		return "[]interface{}{" + strings.Join(elems, ", ") + "}"
+	}
+
+	// no list literals, use a JSON string
+	return quoteString(syntax, (&globalVar{typ: globalList, list: list}).String())
+}
+
+// literal for a map with sorted keys, the types of the values are inferred
+func mapLiteral(syntax string, dict map[string]string) string {
+
+	var pairs []string
+	for _, k := range sortedKeys(dict) {
+		v := scalarLiteral(syntax, inferGlobalType(dict[k]), dict[k])
+		switch syntax {
+		case "bash":
+			pairs = append(pairs, "["+quoteString(syntax, k)+"]="+v)
+		case "zsh":
+			pairs = append(pairs, quoteString(syntax, k)+" "+v)
+		case "python", "javascript", "go":
+			pairs = append(pairs, doubleQuote(k)+": "+v)
+		case "ruby", "perl":
+			pairs = append(pairs, quoteString(syntax, k)+" => "+v)
+		case "lua":
+			pairs = append(pairs, "["+doubleQuote(k)+"] = "+v)
+		}
+	}
+
+	switch syntax {
+	case "bash", "zsh":
+		return "(" + strings.Join(pairs, " ") + ")"
+	case "python", "javascript", "ruby", "perl", "lua":
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case "go":
+		return "map[string]interface{}{" + strings.Join(pairs, ", ") + "}"
+	}
+
+	// no map literals, use a JSON string
+	return quoteString(syntax, (&globalVar{typ: globalMap, dict: dict}).String())
+}
+
+// quote a string, so it is used literally
+func quoteString(syntax, value string) string {
+	switch syntax {
+	case "bash", "sh", "zsh":
+		// nothing is expanded in single quotes, a single quote ends the string
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	case "ruby", "perl":
+		// no interpolation in single quotes
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	}
+	return doubleQuote(value)
+}
+
+// double quoted string with C style escapes
+// valid in python, javascript, lua and go
+func doubleQuote(value string) string {
+
+	var b strings.Builder
+	b.WriteByte('"')
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				b.WriteString(`\x`)
+				if c < 0x10 {
+					b.WriteByte('0')
+				}
+				b.WriteString(strconv.FormatUint(uint64(c), 16))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
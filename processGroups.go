@@ -0,0 +1,149 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// default time processes have to exit after SIGTERM before they are killed
+var defaultShutdownGracePeriod = 5 * time.Second
+
+// set while a command owns the terminal
+// only a single command can be the foreground process group at a time
+var terminalInUse int32
+
+// check if a command that is not detached can own the terminal.
+// this is only the case when commands are executed one at a time:
+// with parallel scheduling only one of the commands could be moved to the foreground,
+// the others would be stopped by SIGTTIN when reading from the terminal and would not receive Ctrl-C.
+// instead ZEUS keeps the terminal, stdin of the commands is not connected
+// and Ctrl-C is passed to the process groups of all running commands by the signal handler
+func canOwnTerminal(async bool) bool {
+	return !async && maxParallel() == 1
+}
+
+// get the configured shutdownGracePeriod
+func shutdownGracePeriod() time.Duration {
+
+	conf.Lock()
+	v := conf.fields.ShutdownGracePeriod
+	conf.Unlock()
+
+	if v == "" {
+		return defaultShutdownGracePeriod
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		Log.WithError(err).Error("invalid shutdownGracePeriod, using " + defaultShutdownGracePeriod.String())
+		return defaultShutdownGracePeriod
+	}
+
+	return d
+}
+
+// check if a process group still has members
+func processGroupAlive(pgid int) bool {
+	err := syscall.Kill(-pgid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// send SIGTERM to a process group and kill it,
+// if it did not exit within the shutdownGracePeriod.
+// returns true if the group had to be killed
+func terminateProcessGroup(pgid int) (killed bool, err error) {
+
+	err = syscall.Kill(-pgid, syscall.SIGTERM)
+	if err != nil {
+		return false, err
+	}
+
+	return killAfter(pgid, time.Now().Add(shutdownGracePeriod()))
+}
+
+// wait for a process group that received SIGTERM to exit
+// and kill it, if it is still alive at the deadline.
+// returns true if the group had to be killed
+func killAfter(pgid int, deadline time.Time) (killed bool, err error) {
+
+	for processGroupAlive(pgid) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !processGroupAlive(pgid) {
+		return false, nil
+	}
+
+	return true, syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+// start the command in its own process group, so all its children can be signaled together.
+// if stdin is a terminal and no other command owns it, the process group is moved to the foreground,
+// so that the command can read from the terminal and receives Ctrl-C directly.
+// the returned function must be called after the command exited, to give the terminal back to zeus
+func startProcessGroup(cmd *exec.Cmd, interactive bool) (release func(), err error) {
+
+	release = func() {}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	fd := int(os.Stdin.Fd())
+	if interactive && term.IsTerminal(fd) && atomic.CompareAndSwapInt32(&terminalInUse, 0, 1) {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = fd
+
+		release = func() {
+			reclaimTerminal(fd)
+			atomic.StoreInt32(&terminalInUse, 0)
+		}
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		release()
+		return func() {}, err
+	}
+
+	return release, nil
+}
+
+// move the process group of zeus back to the foreground of the terminal
+func reclaimTerminal(fd int) {
+
+	// changing the foreground process group from the background raises SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	err := unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, unix.Getpgrp())
+	if err != nil {
+		Log.WithError(err).Error("failed to reclaim the terminal")
+	}
+}
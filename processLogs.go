@@ -0,0 +1,515 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgutz/ansi"
+)
+
+// colors for the name prefixes when multiplexing the output of multiple processes
+var logPrefixColors = []string{"cyan", "yellow", "green", "magenta", "blue", "red"}
+
+// logOptions control how the output of detached processes is read
+type logOptions struct {
+
+	// stream new output until the processes exit
+	follow bool
+
+	// number of lines from the end of the log, zero means all lines
+	lines int
+
+	// only show lines matching the pattern
+	grep *regexp.Regexp
+
+	// colorize the name prefixes
+	colors bool
+}
+
+// a detached process and the prefix for its lines
+type logSource struct {
+	proc   *Process
+	prefix string
+}
+
+func printProcsLogsUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: procs logs <name|id> [<name|id> ...] [-f] [-n N] [grep=pattern]")
+}
+
+// handle procs logs
+// args contains everything after the logs keyword
+func handleProcsLogsCommand(args []string) {
+
+	var (
+		opts = &logOptions{}
+		keys []string
+	)
+
+	conf.Lock()
+	opts.colors = conf.fields.Colors
+	conf.Unlock()
+
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-f":
+			opts.follow = true
+		case args[i] == "-n":
+			if i+1 == len(args) {
+				printProcsLogsUsageErr()
+				return
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				l.Println("invalid number of lines:", args[i])
+				return
+			}
+			opts.lines = n
+		case strings.HasPrefix(args[i], "grep="):
+			re, err := regexp.Compile(strings.TrimPrefix(args[i], "grep="))
+			if err != nil {
+				l.Println("invalid pattern:", err)
+				return
+			}
+			opts.grep = re
+		default:
+			keys = append(keys, args[i])
+		}
+	}
+
+	if len(keys) == 0 {
+		printProcsLogsUsageErr()
+		return
+	}
+
+	procs, err := lookupLogProcesses(keys)
+	if err != nil {
+		l.Println(err)
+		return
+	}
+
+	done, release := catchInterrupt()
+	defer release()
+
+	err = writeProcessLogs(l.Writer(), procs, opts, done)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// stream the logs of detached processes via the web panel
+// processes are selected with the proc query parameter, which can be repeated.
+// supports follow=true, n=<lines> and grep=<pattern>
+var procsLogsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		q    = r.URL.Query()
+		opts = &logOptions{
+			follow: q.Get("follow") == "true",
+		}
+	)
+
+	if v := q.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid number of lines: "+v, http.StatusBadRequest)
+			return
+		}
+		opts.lines = n
+	}
+
+	if v := q.Get("grep"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			http.Error(w, "invalid pattern: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.grep = re
+	}
+
+	procs, err := lookupLogProcesses(q["proc"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	var out io.Writer = w
+	if f, ok := w.(http.Flusher); ok {
+		out = &flushWriter{w: w, f: f}
+	}
+
+	err = writeProcessLogs(out, procs, opts, r.Context().Done())
+	if err != nil {
+		Log.WithError(err).Error("failed to write process logs")
+	}
+})
+
+// flushWriter flushes the response after every write
+// so the client receives followed output immediately
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+// resolve the detached processes for the given names or IDs.
+// the logs of processes from previous sessions or removed from the process list are looked up on disk
+func lookupLogProcesses(keys []string) ([]*Process, error) {
+
+	if len(keys) == 0 {
+		return nil, errors.New("no process specified")
+	}
+
+	var procs []*Process
+	for _, k := range keys {
+		p := findProcess(k)
+		if p == nil {
+			p = findLogFile(k)
+		}
+		if p == nil {
+			return nil, errors.New("unknown process: " + k)
+		}
+		if p.Output == nil {
+			return nil, errors.New("process " + k + " is not detached")
+		}
+		procs = append(procs, p)
+	}
+
+	return procs, nil
+}
+
+// find the most recent log file for a process name or ID in the logs directory.
+// returns an exited process for the log file or nil if there is none
+func findLogFile(key string) *Process {
+
+	files, err := ioutil.ReadDir(zeusDir + "/logs")
+	if err != nil {
+		return nil
+	}
+
+	var (
+		res     *Process
+		modTime time.Time
+	)
+	for _, f := range files {
+
+		// log files are named <name>_<id>.log
+		base := strings.TrimSuffix(f.Name(), ".log")
+		i := strings.LastIndex(base, "_")
+		if f.IsDir() || base == f.Name() || i < 0 {
+			continue
+		}
+		name, id := base[:i], processID(base[i+1:])
+
+		if (string(id) == key || name == key) && (res == nil || f.ModTime().After(modTime)) {
+			res = &Process{
+				Name:   name,
+				ID:     id,
+				Async:  true,
+				Exited: true,
+				Output: &outputBuffer{
+					written: f.Size(),
+					closed:  true,
+				},
+			}
+			modTime = f.ModTime()
+		}
+	}
+
+	return res
+}
+
+// write the logs of the processes to w, multiplexed with name prefixes.
+// when following, returns once all processes have exited or done is closed
+func writeProcessLogs(w io.Writer, procs []*Process, opts *logOptions, done <-chan struct{}) error {
+
+	sources := logSources(procs, opts.colors)
+
+	// subscribe before reading the log files
+	// the offset marks where the persisted output ends and the streamed output begins
+	var (
+		offsets = make([]int64, len(sources))
+		chans   = make([]chan logChunk, len(sources))
+	)
+	if opts.follow {
+		for i, src := range sources {
+			offsets[i], chans[i] = src.proc.Output.subscribeLog()
+			defer src.proc.Output.unsubscribe(chans[i])
+		}
+	}
+
+	// an incomplete last line is completed by the streamed output
+	partials := make([][]byte, len(sources))
+
+	for i, src := range sources {
+
+		lines, partial, err := readLogLines(processLogPath(src.proc.Name, src.proc.ID), offsets[i], opts)
+		if err != nil {
+			return err
+		}
+		partials[i] = partial
+
+		for _, line := range lines {
+			if _, err := io.WriteString(w, src.prefix+maskSecrets(line)+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !opts.follow {
+		return nil
+	}
+
+	var (
+		wg    sync.WaitGroup
+		lines = make(chan string)
+
+		// stops the readers when returning early
+		stop = make(chan struct{})
+	)
+	defer close(stop)
+
+	for i, src := range sources {
+		wg.Add(1)
+		go func(src *logSource, ch chan logChunk, partial []byte, next int64) {
+			defer wg.Done()
+
+			path := processLogPath(src.proc.Name, src.proc.ID)
+
+			send := func(line string) bool {
+				if opts.grep != nil && !opts.grep.MatchString(line) {
+					return true
+				}
+				select {
+				case lines <- src.prefix + maskSecrets(line) + "\n":
+					return true
+				case <-done:
+					return false
+				case <-stop:
+					return false
+				}
+			}
+
+			// send all complete lines
+			sendLines := func() bool {
+				for {
+					i := bytes.IndexByte(partial, '\n')
+					if i < 0 {
+						return true
+					}
+					if !send(string(partial[:i])) {
+						return false
+					}
+					partial = partial[i+1:]
+				}
+			}
+
+			for c := range ch {
+
+				// output that was dropped because the reader was too slow is read from the log file
+				if c.offset > next {
+					missing, err := readLogRange(path, next, c.offset-next)
+					if err != nil {
+						Log.WithError(err).Error("failed to read dropped output")
+					}
+					partial = append(partial, missing...)
+				}
+
+				partial = append(partial, c.data...)
+				next = c.offset + int64(len(c.data))
+
+				if !sendLines() {
+					return
+				}
+			}
+
+			// the process has exited, output dropped at the end is read from the log file
+			rest, err := readLogRange(path, next, -1)
+			if err != nil {
+				Log.WithError(err).Error("failed to read dropped output")
+			}
+			partial = append(partial, rest...)
+			if !sendLines() {
+				return
+			}
+			if len(partial) > 0 {
+				send(string(partial))
+			}
+		}(src, chans[i], partials[i], offsets[i])
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// assign a prefix to every process, aligned to the longest name.
+// the ID is added if multiple processes of the same command are selected
+func logSources(procs []*Process, colors bool) []*logSource {
+
+	var (
+		names   = make(map[string]int)
+		sources []*logSource
+		width   int
+	)
+
+	for _, p := range procs {
+		names[p.Name]++
+	}
+
+	for _, p := range procs {
+		name := p.Name
+		if names[p.Name] > 1 {
+			name += "_" + string(p.ID)
+		}
+		if len(name) > width {
+			width = len(name)
+		}
+		sources = append(sources, &logSource{proc: p, prefix: name})
+	}
+
+	for i, src := range sources {
+		prefix := pad(src.prefix, width) + " | "
+		if colors {
+			prefix = ansi.ColorCode(logPrefixColors[i%len(logPrefixColors)]) + prefix + ansi.Reset
+		}
+		src.prefix = prefix
+	}
+
+	return sources
+}
+
+// read n bytes of a log file starting at offset
+// reads until the end of the file if n is negative
+func readLogRange(path string, offset, n int64) ([]byte, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 {
+		return ioutil.ReadAll(f)
+	}
+
+	b := make([]byte, n)
+	c, err := io.ReadFull(f, b)
+	return b[:c], err
+}
+
+// read the lines of a log file that match the options
+// if limit is greater than zero, only the first limit bytes of the file are read
+// and an incomplete last line is returned separately when following
+func readLogLines(path string, limit int64, opts *logOptions) (lines []string, partial []byte, err error) {
+
+	// nothing has been written before subscribing
+	if opts.follow && limit == 0 {
+		return nil, nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit > 0 {
+		r = io.LimitReader(f, limit)
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	// long lines must not abort reading the log
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last string
+	for scanner.Scan() {
+		last = scanner.Text()
+		if opts.grep != nil && !opts.grep.MatchString(last) {
+			continue
+		}
+		lines = append(lines, last)
+
+		// keep only the last lines in memory
+		if opts.lines > 0 && len(lines) > 2*opts.lines {
+			lines = append([]string(nil), lines[len(lines)-opts.lines:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.follow {
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, limit-1); err == nil && b[0] != '\n' {
+			partial = []byte(last)
+			if len(lines) > 0 && lines[len(lines)-1] == last {
+				lines = lines[:len(lines)-1]
+			}
+		}
+	}
+
+	if opts.lines > 0 && len(lines) > opts.lines {
+		lines = lines[len(lines)-opts.lines:]
+	}
+
+	return lines, partial, nil
+}
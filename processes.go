@@ -26,6 +26,7 @@ import (
 	"os/exec"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -51,6 +52,71 @@ type Process struct {
 
 	// underlying process
 	Proc *os.Process
+
+	// detached processes run in their own process group
+	// and are supervised by zeus
+	Async bool
+
+	// time the process was started
+	Started time.Time
+
+	// combined output of a detached process
+	Output *outputBuffer
+
+	// exit status of a detached process
+	Exited   bool
+	ExitCode *int
+	Err      string
+
+	// number of restarts of a detached process
+	Restarts int
+
+	// result of the last health check
+	Health string
+
+	// set when the process was stopped because it is unhealthy
+	unhealthy bool
+
+	// set when the process was stopped by the user
+	// stopped processes are not restarted
+	Stopped bool
+
+	// closed when the process shall not be restarted anymore
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// closed once the supervisor has finished
+	done chan struct{}
+}
+
+// prevent the supervisor from restarting the process
+// thread safe
+func (p *Process) shutdown() {
+
+	processMapMutex.Lock()
+	p.Stopped = true
+	processMapMutex.Unlock()
+
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// status of the process for the procs builtin
+// the processMapMutex must be held by the caller
+func (p *Process) status() string {
+
+	if !p.Exited {
+		return "running"
+	}
+	if p.ExitCode != nil && *p.ExitCode >= 0 {
+		return "exited (" + strconv.Itoa(*p.ExitCode) + ")"
+	}
+	if p.Err != "" {
+		return "exited (" + p.Err + ")"
+	}
+
+	return "exited"
 }
 
 // add a process to the store
@@ -66,6 +132,54 @@ func addProcess(id processID, name string, p *os.Process, pid int) {
 	}
 }
 
+// add a detached process to the store
+// thread safe
+func addDetachedProcess(id processID, name string, proc *os.Process, output *outputBuffer) *Process {
+
+	p := &Process{
+		Name:    name,
+		ID:      id,
+		PID:     proc.Pid,
+		Proc:    proc,
+		Async:   true,
+		Started: time.Now(),
+		Output:  output,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	processMapMutex.Lock()
+	processMap[id] = p
+	processMapMutex.Unlock()
+
+	return p
+}
+
+// find a process by its ID, PID or command name
+// if multiple processes have been started for a command, the most recent one is returned
+// thread safe
+func findProcess(key string) *Process {
+
+	processMapMutex.Lock()
+	defer processMapMutex.Unlock()
+
+	if p, ok := processMap[processID(key)]; ok {
+		return p
+	}
+
+	var res *Process
+	for _, p := range processMap {
+		if strconv.Itoa(p.PID) == key {
+			return p
+		}
+		if p.Name == key && (res == nil || p.Started.After(res.Started)) {
+			res = p
+		}
+	}
+
+	return res
+}
+
 // delete a process from the store
 // thread safe
 func deleteProcess(id processID) {
@@ -116,30 +230,62 @@ func cleanup(cmdFile *CommandsFile) {
 	}
 }
 
-// clean up the mess
+// stop all spawned processes
+// every command runs in its own process group, the groups receive SIGTERM
+// and are killed if they did not exit within the shutdownGracePeriod
 func clearProcessMap() {
 
-	// l.Println("processMap:", processMap)
+	type terminated struct {
+		id   processID
+		name string
+		pid  int
+	}
+	var procs []terminated
 
 	processMapMutex.Lock()
-	defer processMapMutex.Unlock()
-
-	// range processes
 	for id, p := range processMap {
-		if p.Proc != nil {
-
-			Log.Debug("killing process with ID: "+id+" and PID:", p.Proc.Pid)
 
-			// kill it
-			err := p.Proc.Kill()
-			if err != nil {
-				Log.WithError(err).Debug("failed to kill process with ID: "+id+" and PID:", p.Proc.Pid)
+		// prevent restarts of detached processes
+		if p.Async {
+			p.Stopped = true
+			p.stopOnce.Do(func() {
+				close(p.stop)
+			})
+			if p.Exited {
+				continue
 			}
 		}
+
+		Log.Debug("terminating process group with ID: "+id+" and PID:", p.PID)
+
+		err := syscall.Kill(-p.PID, syscall.SIGTERM)
+		if err != nil {
+			Log.WithError(err).Debug("failed to terminate process group with ID: "+id+" and PID:", p.PID)
+			continue
+		}
+		procs = append(procs, terminated{id: p.ID, name: p.Name, pid: p.PID})
+	}
+	processMapMutex.Unlock()
+
+	var (
+		gracePeriod = shutdownGracePeriod()
+		deadline    = time.Now().Add(gracePeriod)
+	)
+
+	for _, p := range procs {
+
+		killed, err := killAfter(p.pid, deadline)
+		if err != nil {
+			Log.WithError(err).Debug("failed to kill process group with ID: "+p.id+" and PID:", p.pid)
+			continue
+		}
+		if killed {
+			l.Println(cp.Text + "killed " + p.name + " (PID: " + strconv.Itoa(p.pid) + ") forcefully, it did not exit within " + gracePeriod.String() + cp.Reset)
+		}
 	}
 }
 
-// clean up the mess
+// pass a signal to the process groups of all commands
 func passSignalToProcs(sig os.Signal) {
 
 	// l.Println("processMap:", processMap)
@@ -147,28 +293,40 @@ func passSignalToProcs(sig os.Signal) {
 	processMapMutex.Lock()
 	defer processMapMutex.Unlock()
 
+	signal, ok := sig.(syscall.Signal)
+	if !ok {
+		return
+	}
+
 	// range processes
+	// detached processes are not affected by signals for the shell
 	for _, p := range processMap {
-		if p.Proc != nil {
+		if p.Async {
+			continue
+		}
 
-			Log.Debug("passing signal "+sig.String()+" to PID: ", p.Proc.Pid)
+		Log.Debug("passing signal "+sig.String()+" to process group: ", p.PID)
 
-			err := p.Proc.Signal(sig)
-			if err != nil {
-				Log.WithError(err).Debug("failed to pass signal "+sig.String()+" to PID:", p.Proc.Pid)
-			}
+		err := syscall.Kill(-p.PID, signal)
+		if err != nil {
+			Log.WithError(err).Debug("failed to pass signal "+sig.String()+" to process group:", p.PID)
 		}
 	}
 }
 
 func printProcsCommandUsageErr() {
 	l.Println(ErrInvalidUsage)
-	l.Println("usage: procs [detach <command>] [attach <pid>] [kill <pid>]")
+	l.Println("usage: procs [detach <command>] [attach <id|pid|name>] [kill <id|pid|name>] [logs <id|name> [-f] [-n N] [grep=pattern]]")
 }
 
 // manage spawned processes
 func handleProcsCommand(args []string) {
 
+	if len(args) > 1 && args[1] == "logs" {
+		handleProcsLogsCommand(args[2:])
+		return
+	}
+
 	if len(args) < 3 {
 		printProcs()
 		return
@@ -188,30 +346,56 @@ func handleProcsCommand(args []string) {
 		} else {
 			l.Println("invalid command:", args[2])
 		}
-	// attach to a runnning async process with screen -r
+	// stream the output of a detached process
 	case "attach":
-		cmd := exec.Command("screen", "-r", args[2])
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		cmd.Stdin = os.Stdin
-		cmd.Env = os.Environ()
-		err := cmd.Run()
-		if err != nil {
-			Log.WithError(err).Error("failed to attach to PID: ", args[2])
+		p := findProcess(args[2])
+		if p == nil {
+			l.Println("unknown process:", args[2])
+			return
 		}
-	// kill a process by PID
+		if p.Output == nil {
+			l.Println("process " + args[2] + " is not detached")
+			return
+		}
+		attachProcess(p)
+	// kill a process
+	// exited detached processes are removed from the list
 	case "kill":
-		pid, err := strconv.Atoi(args[2])
-		if err != nil {
-			Log.WithError(err).Error("invalid integer value: ", args[2])
+		p := findProcess(args[2])
+		if p == nil {
+			l.Println("unknown process:", args[2])
 			return
 		}
-		err = exec.Command("kill", args[2]).Run()
+
+		// prevent restarts of detached processes
+		if p.Async {
+			p.shutdown()
+		}
+
+		// the supervisor replaces the PID when restarting a process
+		processMapMutex.Lock()
+		exited := p.Exited
+		pid := p.PID
+		processMapMutex.Unlock()
+
+		if exited {
+			deleteProcess(p.ID)
+			return
+		}
+
+		killed, err := terminateProcessGroup(pid)
 		if err != nil {
-			Log.WithError(err).Error("failed to kill PID: ", args[2])
+			Log.WithError(err).Error("failed to kill process group: ", pid)
 			return
 		}
-		deleteProcessByPID(pid)
+		if killed {
+			l.Println(cp.Text + "killed " + p.Name + " (PID: " + strconv.Itoa(pid) + ") forcefully, it did not exit within " + shutdownGracePeriod().String() + cp.Reset)
+		}
+
+		// the supervisor records the exit status of detached processes
+		if !p.Async {
+			deleteProcessByPID(pid)
+		}
 	default:
 		printProcsCommandUsageErr()
 	}
@@ -221,8 +405,12 @@ func printProcs() {
 	processMapMutex.Lock()
 	defer processMapMutex.Unlock()
 
-	l.Println(cp.Prompt + pad("ID", 20) + pad("PID", 10) + "Name")
+	l.Println(cp.Prompt + pad("ID", 20) + pad("PID", 10) + pad("Name", 20) + pad("Status", 20) + pad("Health", 12) + "Restarts")
 	for _, p := range processMap {
-		l.Println(cp.Text + pad(string(p.ID), 20) + pad(strconv.Itoa(p.PID), 10) + p.Name)
+		health := p.Health
+		if health == "" {
+			health = "-"
+		}
+		l.Println(cp.Text + pad(string(p.ID), 20) + pad(strconv.Itoa(p.PID), 10) + pad(p.Name, 20) + pad(p.status(), 20) + pad(health, 12) + strconv.Itoa(p.Restarts))
 	}
 }
@@ -0,0 +1,227 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dreadl0ck/readline"
+	"golang.org/x/term"
+)
+
+// ErrPromptCancelled is returned when the user interrupts a prompt for a missing argument
+var ErrPromptCancelled = errors.New("prompt cancelled")
+
+// reads the input for a prompt, secrets are read without echo
+type promptReader func(prompt string, secret bool) (string, error)
+
+// check if missing arguments can be prompted for.
+// this is only possible in the interactive shell, when stdin is a terminal
+func canPrompt() bool {
+	return rl != nil && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// returns the reader for prompts in the interactive shell,
+// or nil if missing arguments can not be prompted for
+func shellPrompt() promptReader {
+	if !canPrompt() {
+		return nil
+	}
+	return readPromptInput
+}
+
+// prompt for the arguments of a command invocation from the interactive shell, if required ones are missing.
+// all arguments that have not been supplied are asked for in declaration order,
+// the returned args contain the entered values in the label=value format
+func (c *command) promptMissingArgs(args []string) ([]string, error) {
+
+	if !canPrompt() {
+		return args, nil
+	}
+
+	return c.promptArgs(args, readPromptInput)
+}
+
+// prompt for missing arguments, read is used to get the input for a prompt
+func (c *command) promptArgs(args []string, read promptReader) ([]string, error) {
+
+	labeled, passthrough, err := normalizeArgs(c.args, args)
+	if err != nil {
+		// the error will be reported when the arguments are parsed
+		return args, nil
+	}
+
+	set := argLabels(labeled)
+	if !c.missingRequired(set) {
+		return args, nil
+	}
+
+	l.Println(cp.Text + c.name + " is missing arguments, press Enter to keep a default or Ctrl-C to cancel")
+
+	for _, a := range c.args {
+		if set[a.name] {
+			continue
+		}
+		value, err := a.promptValue(read)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			continue
+		}
+
+		// the input for a variadic argument is a comma separated list
+		if a.argType.variadic {
+			for _, v := range splitList(value) {
+				labeled = append(labeled, a.name+"="+v)
+			}
+		} else {
+			labeled = append(labeled, a.name+"="+value)
+		}
+	}
+
+	if len(passthrough) > 0 {
+		labeled = append(append(labeled, "--"), passthrough...)
+	}
+
+	return labeled, nil
+}
+
+// check if required arguments have not been supplied in args
+func (c *command) missingArgs(args []string) bool {
+
+	labeled, _, err := normalizeArgs(c.args, args)
+	if err != nil {
+		return false
+	}
+
+	return c.missingRequired(argLabels(labeled))
+}
+
+// check if a required argument is not in the set of supplied labels
+func (c *command) missingRequired(set map[string]bool) bool {
+	for _, a := range c.args {
+		if !a.optional && !set[a.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// collect the labels of arguments in the label=value format
+func argLabels(labeled []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, a := range labeled {
+		set[strings.SplitN(a, "=", 2)[0]] = true
+	}
+	return set
+}
+
+// ask for the value of an argument until a valid value was entered.
+// an empty input keeps the default of optional arguments
+func (a *commandArg) promptValue(read promptReader) (string, error) {
+
+	if a.argType.name == argTypeEnum {
+		for i, v := range a.argType.values {
+			l.Println(cp.Text + "  " + strconv.Itoa(i+1) + ") " + v)
+		}
+	}
+
+	prompt := a.promptText()
+	for {
+		value, err := read(prompt, a.argType.name == argTypeSecret)
+		if err != nil {
+			return "", err
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			if a.optional {
+				return "", nil
+			}
+			continue
+		}
+
+		// enum values can be chosen by their number
+		if a.argType.name == argTypeEnum {
+			if n, err := strconv.Atoi(value); err == nil && n > 0 && n <= len(a.argType.values) {
+				value = a.argType.values[n-1]
+			}
+		}
+
+		if err := a.argType.validate(value); err != nil {
+			l.Println(cp.Text + "invalid value: " + err.Error())
+			continue
+		}
+
+		return value, nil
+	}
+}
+
+// prompt for an argument, e.g. tag:String [latest]:
+func (a *commandArg) promptText() string {
+
+	var hint string
+	switch {
+	case a.argType.name == argTypeEnum:
+		hint = " [1-" + strconv.Itoa(len(a.argType.values)) + "]"
+	case a.argType.name == argTypeSecret:
+		// defaults of secrets are not shown
+	case a.optional && a.defaultValue != "":
+		hint = " [" + strings.TrimSpace(a.defaultValue) + "]"
+	case a.optional:
+		hint = " [" + a.argType.zeroValue() + "]"
+	case a.argType.name == argTypeBool:
+		hint = " [true|false]"
+	}
+
+	return cp.Prompt + a.name + ":" + a.argType.String() + hint + ": " + cp.Text
+}
+
+// read the input for a prompt with the readline instance of the interactive shell.
+// secrets are read without echo, the input is not added to the history
+func readPromptInput(prompt string, secret bool) (string, error) {
+
+	var (
+		value string
+		err   error
+	)
+
+	if secret {
+		var b []byte
+		b, err = rl.ReadPassword(prompt)
+		value = string(b)
+	} else {
+		rl.HistoryDisable()
+		rl.SetPrompt(prompt)
+		value, err = rl.Readline()
+		rl.SetPrompt(printPrompt())
+		rl.HistoryEnable()
+	}
+
+	if err == readline.ErrInterrupt || err == io.EOF {
+		return "", ErrPromptCancelled
+	}
+
+	return value, err
+}
@@ -18,8 +18,412 @@
 
 package main
 
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
 var (
 	// format for TimeStamp in report
 	timestampFormat = "[Mon Jan 2 15:04:05 2006]"
 	// reportFileHandle *os.File
+
+	// number of runs included in a report by default
+	defaultReportRuns = 20
+
+	// maximum number of rows for the command tables
+	reportTableRows = 10
+)
+
+// reportTable is a single section of a report
+type reportTable struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+// statistics for a single command over multiple runs
+type commandStats struct {
+	name       string
+	executions int
+	failures   int
+	skips      int
+	total      float64
+	max        float64
+
+	// durations of successful executions, oldest first
+	durations []float64
+}
+
+func printReportCommandUsageErr() {
+	l.Println("invalid usage")
+	l.Println("usage: report [terminal|markdown|html] [runs]")
+}
+
+// handle the report builtin
+func handleReportCommand(args []string) {
+
+	var (
+		format = "terminal"
+		n      = defaultReportRuns
+	)
+
+	for _, a := range args[1:] {
+		switch a {
+		case "terminal", "markdown", "html":
+			format = a
+		default:
+			i, err := strconv.Atoi(a)
+			if err != nil || i < 1 {
+				printReportCommandUsageErr()
+				return
+			}
+			n = i
+		}
+	}
+
+	runs, err := loadRuns(n)
+	if err != nil {
+		l.Println("failed to load run history:", err)
+		return
+	}
+
+	err = writeReport(l.Writer(), runs, format)
+	if err != nil {
+		l.Println(err)
+	}
+}
+
+// serve the HTML report via the web panel
+// the number of runs can be set with the runs query parameter
+var reportHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	n := defaultReportRuns
+	if v := r.URL.Query().Get("runs"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 {
+			http.Error(w, "invalid number of runs: "+v, http.StatusBadRequest)
+			return
+		}
+		n = i
+	}
+
+	runs, err := loadRuns(n)
+	if err != nil {
+		Log.WithError(err).Error("failed to load run history")
+		http.Error(w, "failed to load run history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+
+	err = writeReport(w, runs, "html")
+	if err != nil {
+		Log.WithError(err).Error("failed to write report")
+	}
+})
+
+// render a report for the given runs in the requested format
+func writeReport(w io.Writer, runs []*runRecord, format string) error {
+
+	tables := reportTables(runs)
+
+	switch format {
+	case "terminal":
+		for _, t := range tables {
+			t.writeTerminal(w)
+		}
+	case "markdown":
+		for _, t := range tables {
+			t.writeMarkdown(w)
+		}
+	case "html":
+		var b bytes.Buffer
+		b.WriteString("# ZEUS Report\n\n")
+		for _, t := range tables {
+			t.writeMarkdown(&b)
+		}
+
+		// use the same template as the wiki
+		t, err := template.New("report").Parse(wikiIndexHTML)
+		if err != nil {
+			return err
+		}
+
+		return t.Execute(w, template.HTML(blackfriday.Run(b.Bytes())))
+	default:
+		return errors.New("unknown report format: " + format)
+	}
+
+	return nil
+}
+
+// assemble the sections of a report
+func reportTables(runs []*runRecord) []*reportTable {
+
+	var (
+		failedRuns int
+		total      float64
+		stats      = make(map[string]*commandStats)
+		recent     = &reportTable{
+			title:  "Recent runs",
+			header: []string{"time", "invocation", "status", "duration", "build"},
+		}
+	)
+
+	for _, r := range runs {
+
+		status := "success"
+		if !r.Success {
+			status = "failed"
+			failedRuns++
+		}
+		total += r.DurationMS
+
+		recent.rows = append(recent.rows, []string{
+			r.Start.Format(timestampFormat),
+			r.Invocation,
+			status,
+			formatMS(r.DurationMS),
+			strconv.Itoa(r.BuildNumber),
+		})
+
+		for _, c := range r.Commands {
+
+			st, ok := stats[c.Command]
+			if !ok {
+				st = &commandStats{name: c.Command}
+				stats[c.Command] = st
+			}
+
+			switch c.Status {
+			case statusFinished:
+				st.executions++
+				st.total += c.DurationMS
+				st.durations = append(st.durations, c.DurationMS)
+				if c.DurationMS > st.max {
+					st.max = c.DurationMS
+				}
+			case statusFailed:
+				st.executions++
+				st.failures++
+			case statusSkipped:
+				st.skips++
+			}
+		}
+	}
+
+	// newest runs first
+	for i, j := 0, len(recent.rows)-1; i < j; i, j = i+1, j-1 {
+		recent.rows[i], recent.rows[j] = recent.rows[j], recent.rows[i]
+	}
+
+	summary := &reportTable{
+		title:  "Summary",
+		header: []string{"runs", "failed", "failure rate", "average duration"},
+		rows: [][]string{{
+			strconv.Itoa(len(runs)),
+			strconv.Itoa(failedRuns),
+			formatRate(failedRuns, len(runs)),
+			formatMS(average(total, len(runs))),
+		}},
+	}
+
+	var all []*commandStats
+	for _, st := range stats {
+		all = append(all, st)
+	}
+
+	// slowest commands by average duration
+	slowest := &reportTable{
+		title:  "Slowest commands",
+		header: []string{"command", "executions", "average", "max"},
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return average(all[i].total, len(all[i].durations)) > average(all[j].total, len(all[j].durations))
+	})
+	for _, st := range all {
+		if len(st.durations) == 0 || len(slowest.rows) == reportTableRows {
+			continue
+		}
+		slowest.rows = append(slowest.rows, []string{
+			st.name,
+			strconv.Itoa(st.executions),
+			formatMS(average(st.total, len(st.durations))),
+			formatMS(st.max),
+		})
+	}
+
+	// commands with the highest failure rate
+	failures := &reportTable{
+		title:  "Failure rate",
+		header: []string{"command", "executions", "failures", "rate", "skipped"},
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return rate(all[i].failures, all[i].executions) > rate(all[j].failures, all[j].executions)
+	})
+	for _, st := range all {
+		if len(failures.rows) == reportTableRows {
+			break
+		}
+		failures.rows = append(failures.rows, []string{
+			st.name,
+			strconv.Itoa(st.executions),
+			strconv.Itoa(st.failures),
+			formatRate(st.failures, st.executions),
+			strconv.Itoa(st.skips),
+		})
+	}
+
+	// compare the average duration of the older and the newer half of the executions
+	trends := &reportTable{
+		title:  "Trends",
+		header: []string{"command", "older", "newer", "change"},
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	for _, st := range all {
+
+		if len(st.durations) < 2 {
+			continue
+		}
+
+		var (
+			half         = len(st.durations) / 2
+			older, newer float64
+		)
+		for _, d := range st.durations[:half] {
+			older += d
+		}
+		for _, d := range st.durations[half:] {
+			newer += d
+		}
+		older = average(older, half)
+		newer = average(newer, len(st.durations)-half)
+
+		change := "n/a"
+		if older > 0 {
+			change = strconv.FormatFloat((newer-older)/older*100, 'f', 1, 64) + "%"
+			if newer >= older {
+				change = "+" + change
+			}
+		}
+
+		trends.rows = append(trends.rows, []string{st.name, formatMS(older), formatMS(newer), change})
+	}
+
+	return []*reportTable{summary, slowest, failures, trends, recent}
+}
+
+// print the table aligned to the terminal
+func (t *reportTable) writeTerminal(w io.Writer) {
+
+	widths := make([]int, len(t.header))
+	for i, h := range t.header {
+		widths[i] = len(h)
+	}
+	for _, row := range t.rows {
+		for i, col := range row {
+			if len(col) > widths[i] {
+				widths[i] = len(col)
+			}
+		}
+	}
+
+	io.WriteString(w, "\n"+cp.Prompt+t.title+cp.Reset+"\n")
+
+	if len(t.rows) == 0 {
+		io.WriteString(w, cp.Text+"no data\n"+cp.Reset)
+		return
+	}
+
+	var header string
+	for i, h := range t.header {
+		header += pad(h, widths[i]+2)
+	}
+	io.WriteString(w, cp.CmdName+strings.TrimSpace(header)+cp.Reset+"\n")
+
+	for _, row := range t.rows {
+		var line string
+		for i, col := range row {
+			line += pad(col, widths[i]+2)
+		}
+		io.WriteString(w, cp.Text+strings.TrimSpace(line)+cp.Reset+"\n")
+	}
+}
+
+// write the table in markdown format
+func (t *reportTable) writeMarkdown(w io.Writer) {
+
+	io.WriteString(w, "## "+t.title+"\n\n")
+
+	if len(t.rows) == 0 {
+		io.WriteString(w, "no data\n\n")
+		return
+	}
+
+	io.WriteString(w, "| "+strings.Join(t.header, " | ")+" |\n")
+	io.WriteString(w, "|"+strings.Repeat(" --- |", len(t.header))+"\n")
+
+	for _, row := range t.rows {
+		var cols []string
+		for _, col := range row {
+			cols = append(cols, escapeMarkdown(col))
+		}
+		io.WriteString(w, "| "+strings.Join(cols, " | ")+" |\n")
+	}
+	io.WriteString(w, "\n")
+}
+
+// characters that are escaped in the values of a markdown table
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"`", "\\`",
+	"*", "\\*",
+	"_", "\\_",
+	"[", "\\[",
+	"]", "\\]",
+	"<", "\\<",
+	">", "\\>",
+	"&", "\\&",
+	"|", "\\|",
 )
+
+// escape a value for a markdown table.
+// values like the invocation are user controlled, they must not be rendered as links or raw HTML in the html report
+func escapeMarkdown(value string) string {
+	return markdownEscaper.Replace(value)
+}
+
+func average(total float64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func formatRate(n, total int) string {
+	return strconv.FormatFloat(rate(n, total)*100, 'f', 1, 64) + "%"
+}
+
+// format a duration in milliseconds
+func formatMS(ms float64) string {
+	return (time.Duration(ms * float64(time.Millisecond))).Round(time.Millisecond).String()
+}
@@ -0,0 +1,332 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resourceUsage of a single command execution
+// collected from the rusage of the process after it exited
+type resourceUsage struct {
+	UserCPUMS   float64 `json:"userCpuMs"`
+	SystemCPUMS float64 `json:"systemCpuMs"`
+	MaxRSSKB    int64   `json:"maxRssKb"`
+	BlockInput  int64   `json:"blockInput"`
+	BlockOutput int64   `json:"blockOutput"`
+}
+
+// get the resource usage of an exited process
+// returns nil if the information is not available
+func resourceUsageOf(state *os.ProcessState) *resourceUsage {
+
+	if state == nil {
+		return nil
+	}
+
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return nil
+	}
+
+	// the maximum resident set size is reported in bytes on macOS and in kilobytes elsewhere
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS == "darwin" {
+		maxRSS /= 1024
+	}
+
+	return &resourceUsage{
+		UserCPUMS:   durationMS(time.Duration(ru.Utime.Nano())),
+		SystemCPUMS: durationMS(time.Duration(ru.Stime.Nano())),
+		MaxRSSKB:    maxRSS,
+		BlockInput:  int64(ru.Inblock),
+		BlockOutput: int64(ru.Oublock),
+	}
+}
+
+// summary for the finished line
+func (u *resourceUsage) String() string {
+	return "user " + formatMS(u.UserCPUMS) +
+		", sys " + formatMS(u.SystemCPUMS) +
+		", max rss " + formatKB(u.MaxRSSKB) +
+		", block i/o " + strconv.FormatInt(u.BlockInput, 10) + "/" + strconv.FormatInt(u.BlockOutput, 10)
+}
+
+// resource usage appended to the finished line
+func resourceSummary(u *resourceUsage) string {
+	if u == nil {
+		return ""
+	}
+	return cp.Text + "(" + u.String() + ")"
+}
+
+// format a size in kilobytes
+func formatKB(kb int64) string {
+	switch {
+	case kb >= 1024*1024:
+		return strconv.FormatFloat(float64(kb)/(1024*1024), 'f', 1, 64) + "GB"
+	case kb >= 1024:
+		return strconv.FormatFloat(float64(kb)/1024, 'f', 1, 64) + "MB"
+	}
+	return strconv.FormatInt(kb, 10) + "KB"
+}
+
+// limitsData is the limits section of a command in the commandsFile
+type limitsData struct {
+
+	// maximum size of the data segment, e.g. 512MB or 2GB
+	Memory string `yaml:"memory"`
+
+	// maximum CPU time, e.g. 30s or 5m
+	CPU string `yaml:"cpu"`
+
+	// maximum number of open files
+	OpenFiles int `yaml:"openFiles"`
+}
+
+// first argument when zeus is executed to apply the resource limits of a command
+const limitsInitArg = "__limits-init"
+
+// when executed to apply resource limits,
+// set the rlimits and replace the process with the command
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == limitsInitArg {
+		err := limitsInit(os.Args[2:])
+		fmt.Fprintln(os.Stderr, "zeus limits:", err)
+		os.Exit(1)
+	}
+}
+
+// resourceLimits are applied as rlimits to the interpreter of a command.
+// the memory limit is set as RLIMIT_DATA, which covers the heap and private writable mappings.
+// unlike RLIMIT_AS it does not count reserved address space,
+// which runtimes like Go, Node or the JVM reserve in large amounts at startup
+type resourceLimits struct {
+	memoryKB   int64
+	cpuSeconds int64
+	openFiles  int
+}
+
+// validate the limits section of a command
+func (d *limitsData) init(name string) (*resourceLimits, error) {
+
+	lim := &resourceLimits{
+		openFiles: d.OpenFiles,
+	}
+
+	if d.Memory != "" {
+		kb, err := parseSizeKB(d.Memory)
+		if err != nil {
+			return nil, errors.New("invalid memory limit for command " + name + ": " + err.Error())
+		}
+		lim.memoryKB = kb
+	}
+
+	if d.CPU != "" {
+		cpu, err := time.ParseDuration(d.CPU)
+		if err != nil {
+			return nil, errors.New("invalid cpu limit for command " + name + ": " + err.Error())
+		}
+		if cpu <= 0 {
+			return nil, errors.New("invalid cpu limit for command " + name + ": must be positive")
+		}
+		// rlimits for CPU time have a resolution of seconds
+		lim.cpuSeconds = int64(math.Ceil(cpu.Seconds()))
+	}
+
+	if d.OpenFiles < 0 {
+		return nil, errors.New("invalid openFiles limit for command " + name + ": must not be negative")
+	}
+
+	return lim, nil
+}
+
+// parse a size like 512MB into kilobytes
+func parseSizeKB(size string) (int64, error) {
+
+	var (
+		s     = strings.ToUpper(strings.TrimSpace(size))
+		units = []struct {
+			suffix string
+			factor float64
+		}{
+			{"GB", 1024 * 1024},
+			{"MB", 1024},
+			{"KB", 1},
+			{"B", 1.0 / 1024},
+		}
+		factor = 1.0 / 1024
+	)
+
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.New("expected a positive size like 512MB, got: " + size)
+	}
+
+	kb := int64(math.Ceil(v * factor))
+	if kb < 1 {
+		kb = 1
+	}
+
+	return kb, nil
+}
+
+// run the command through zeus, which sets the rlimits
+// and then replaces itself with the interpreter, so no shell is added to the process tree
+func (lim *resourceLimits) apply(cmd *exec.Cmd) error {
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.New("failed to locate zeus executable: " + err.Error())
+	}
+
+	cmd.Args = append([]string{
+		"zeus",
+		limitsInitArg,
+		strconv.FormatInt(lim.memoryKB, 10),
+		strconv.FormatInt(lim.cpuSeconds, 10),
+		strconv.Itoa(lim.openFiles),
+		cmd.Path,
+	}, cmd.Args...)
+	cmd.Path = exe
+
+	return nil
+}
+
+// set the rlimits and execute the command.
+// args contains the memory limit in kilobytes, the cpu limit in seconds, the open files limit,
+// the path of the executable and the argv of the command.
+// zero means no limit. only returns if an error occurred
+func limitsInit(args []string) error {
+
+	if len(args) < 5 {
+		return errors.New("missing arguments")
+	}
+
+	var values [3]uint64
+	for i := range values {
+		v, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			return errors.New("invalid limit: " + args[i])
+		}
+		values[i] = v
+	}
+
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"memory", syscall.RLIMIT_DATA, values[0] * 1024},
+		{"cpu", syscall.RLIMIT_CPU, values[1]},
+		{"openFiles", syscall.RLIMIT_NOFILE, values[2]},
+	}
+
+	for _, lim := range limits {
+		if lim.value == 0 {
+			continue
+		}
+		err := syscall.Setrlimit(lim.resource, &syscall.Rlimit{Cur: lim.value, Max: lim.value})
+		if err != nil {
+			return errors.New("failed to set " + lim.name + " limit: " + err.Error())
+		}
+	}
+
+	return syscall.Exec(args[3], args[4:], os.Environ())
+}
+
+// description of the limits for the dump and explain output
+func (lim *resourceLimits) String() string {
+
+	var parts []string
+	if lim.memoryKB > 0 {
+		parts = append(parts, "memory "+formatKB(lim.memoryKB))
+	}
+	if lim.cpuSeconds > 0 {
+		parts = append(parts, "cpu "+strconv.FormatInt(lim.cpuSeconds, 10)+"s")
+	}
+	if lim.openFiles > 0 {
+		parts = append(parts, "openFiles "+strconv.Itoa(lim.openFiles))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// print the resource usage of the most recent execution of each command from the run history
+func printResourceUsage() {
+
+	runs, err := loadRuns(defaultReportRuns)
+	if err != nil {
+		l.Println("failed to load run history:", err)
+		return
+	}
+
+	latest := make(map[string]*commandRecord)
+	for _, r := range runs {
+		for _, c := range r.Commands {
+			if c.Resources != nil {
+				latest[c.Command] = c
+			}
+		}
+	}
+
+	t := &reportTable{
+		title:  "Resource usage (most recent execution)",
+		header: []string{"command", "status", "duration", "user", "sys", "max rss", "block i/o"},
+	}
+
+	var names []string
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := latest[name]
+		t.rows = append(t.rows, []string{
+			name,
+			c.Status,
+			formatMS(c.DurationMS),
+			formatMS(c.Resources.UserCPUMS),
+			formatMS(c.Resources.SystemCPUMS),
+			formatKB(c.Resources.MaxRSSKB),
+			strconv.FormatInt(c.Resources.BlockInput, 10) + "/" + strconv.FormatInt(c.Resources.BlockOutput, 10),
+		})
+	}
+
+	t.writeTerminal(l.Writer())
+}
@@ -0,0 +1,151 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// first argument when zeus is executed as the init process of a sandbox
+const sandboxInitArg = "__sandbox-init"
+
+// sandboxData is the sandbox section of a command in the commandsFile
+type sandboxData struct {
+
+	// allow network access
+	Network bool `yaml:"network"`
+
+	// additional writable paths, besides the outputs of the command
+	Writable []string `yaml:"writable"`
+}
+
+// sandbox restricts the filesystem and network access of a command.
+// the whole filesystem is read only, only the outputs and writable paths can be modified,
+// /tmp and /dev/shm are private and the network is disabled unless allowed
+type sandbox struct {
+	network  bool
+	writable []string
+}
+
+// sandboxConfig is passed to the init process of the sandbox
+type sandboxConfig struct {
+	Root     string   `json:"root"`
+	WorkDir  string   `json:"workDir"`
+	Writable []string `json:"writable"`
+}
+
+// validate the sandbox section of a command
+func (d *sandboxData) init(name string) (*sandbox, error) {
+
+	for _, p := range d.Writable {
+		if strings.TrimSpace(p) == "" {
+			return nil, errors.New("invalid sandbox for command " + name + ": empty writable path")
+		}
+	}
+
+	return &sandbox{
+		network:  d.Network,
+		writable: d.Writable,
+	}, nil
+}
+
+// description of the sandbox for the dump and explain output
+func (sb *sandbox) String() string {
+
+	desc := "read only filesystem"
+	if len(sb.writable) > 0 {
+		desc += ", writable " + strings.Join(sb.writable, " ")
+	}
+	if sb.network {
+		desc += ", network"
+	} else {
+		desc += ", no network"
+	}
+
+	return desc
+}
+
+// resolve the writable directories of the sandbox for a command with the given outputs.
+// a trailing slash marks a directory, for files the directory containing them is writable,
+// so they can also be replaced by renaming a temporary file, like many tools do.
+// directories that do not exist yet are created,
+// the returned cleanup function removes created directories that are still empty
+func (sb *sandbox) prepare(outputs []string) (dirs []string, cleanup func(), err error) {
+
+	var (
+		created []string
+		seen    = make(map[string]bool)
+	)
+	cleanup = func() {
+		// nested directories first, fails for directories that are not empty
+		for i := len(created) - 1; i >= 0; i-- {
+			os.Remove(created[i])
+		}
+	}
+
+	for _, p := range append(append([]string{}, outputs...), sb.writable...) {
+
+		dir, err := filepath.Abs(expandHome(p))
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		if !strings.HasSuffix(p, "/") {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				dir = filepath.Dir(dir)
+			}
+		}
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		// remember the missing directories, to remove them again
+		var missing []string
+		for d := dir; d != filepath.Dir(d); d = filepath.Dir(d) {
+			if _, err := os.Stat(d); err == nil {
+				break
+			}
+			missing = append([]string{d}, missing...)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			cleanup()
+			return nil, nil, errors.New("failed to create writable directory for sandbox: " + err.Error())
+		}
+		created = append(created, missing...)
+
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, cleanup, nil
+}
+
+// expand a leading ~ to the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + strings.TrimPrefix(path, "~")
+		}
+	}
+	return path
+}
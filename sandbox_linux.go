@@ -0,0 +1,258 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// when executed as the init process of a sandbox,
+// set up the mounts and replace the process with the command
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxInitArg {
+		err := sandboxInit(os.Args[2:])
+		fmt.Fprintln(os.Stderr, "zeus sandbox:", err)
+		os.Exit(1)
+	}
+}
+
+// run the command in new user, mount and network namespaces.
+// zeus is executed again as the init process of the sandbox,
+// which sets up the mounts and then executes the original argv
+func (sb *sandbox) apply(cmd *exec.Cmd, outputs []string) (cleanup func(), err error) {
+
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	writable, cleanup, err := sb.prepare(outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir := cmd.Dir
+	if workDir == "" {
+		workDir = root
+	}
+	workDir, err = filepath.Abs(workDir)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	cfg, err := json.Marshal(&sandboxConfig{
+		Root:     root,
+		WorkDir:  workDir,
+		Writable: writable,
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	cmd.Args = append([]string{"zeus", sandboxInitArg, string(cfg), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS)
+	if !sb.network {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags = flags
+
+	// the user is mapped to root inside the namespace, which allows to mount
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+
+	return cleanup, nil
+}
+
+// set up the mounts of the sandbox and execute the command.
+// args contains the config, the path of the executable and the argv of the command
+// only returns if an error occurred
+func sandboxInit(args []string) error {
+
+	if len(args) < 3 {
+		return errors.New("missing arguments")
+	}
+
+	var cfg sandboxConfig
+	err := json.Unmarshal([]byte(args[0]), &cfg)
+	if err != nil {
+		return errors.New("invalid config: " + err.Error())
+	}
+
+	// do not propagate any mounts to the parent namespace
+	err = unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return errors.New("failed to make mounts private: " + err.Error())
+	}
+
+	// keep references to the paths, since the project might be below /tmp
+	rootFD, err := unix.Open(cfg.Root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.New("failed to open project root: " + err.Error())
+	}
+
+	writableFDs := make([]int, len(cfg.Writable))
+	for i, p := range cfg.Writable {
+		writableFDs[i], err = unix.Open(p, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return errors.New("failed to open writable path: " + err.Error())
+		}
+	}
+
+	// private /tmp and /dev/shm
+	allowed := map[string]bool{}
+	for _, p := range []string{"/tmp", "/dev/shm"} {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		err = unix.Mount("tmpfs", p, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+		if err != nil {
+			return errors.New("failed to mount " + p + ": " + err.Error())
+		}
+		allowed[p] = true
+	}
+
+	err = bindMount(rootFD, cfg.Root, unix.MS_REC)
+	if err != nil {
+		return errors.New("failed to mount project root: " + err.Error())
+	}
+
+	// the writable paths are mounted before everything else is made read only
+	for i, p := range cfg.Writable {
+		err = bindMount(writableFDs[i], p, 0)
+		if err != nil {
+			return errors.New("failed to mount writable path " + p + ": " + err.Error())
+		}
+		allowed[p] = true
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, p := range mounts {
+		if allowed[p] {
+			continue
+		}
+		err = remountReadOnly(p)
+		if err != nil {
+			return errors.New("failed to make " + p + " read only: " + err.Error())
+		}
+	}
+
+	// the previous working directory still refers to the mounts of the host
+	err = os.Chdir(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(args[1], args[2:], os.Environ())
+}
+
+// bind mount the directory referenced by fd to the target path and close the fd.
+// the mount point is created, if it does not exist
+func bindMount(fd int, target string, flags uintptr) error {
+
+	defer unix.Close(fd)
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return err
+	}
+
+	return unix.Mount("/proc/self/fd/"+strconv.Itoa(fd), target, "", unix.MS_BIND|flags, "")
+}
+
+// all mount points of the mount namespace
+func mountPoints() ([]string, error) {
+
+	contents, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, errors.New("failed to read mounts: " + err.Error())
+	}
+
+	var (
+		mounts []string
+		seen   = make(map[string]bool)
+	)
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		p := unescapeMountPath(fields[4])
+		if !seen[p] {
+			seen[p] = true
+			mounts = append(mounts, p)
+		}
+	}
+
+	return mounts, nil
+}
+
+// special characters in the paths of /proc/self/mountinfo are escaped as octal numbers, e.g. \040 for a space
+func unescapeMountPath(p string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+3 < len(p) {
+			if n, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+
+	return b.String()
+}
+
+// remount a mount point read only.
+// flags of mounts inherited from the parent namespace are locked in a user namespace and must be kept
+func remountReadOnly(p string) error {
+
+	var st unix.Statfs_t
+	err := unix.Statfs(p, &st)
+	if err != nil {
+		return err
+	}
+	locked := uintptr(st.Flags) & (unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC | unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME)
+
+	return unix.Mount("", p, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|locked, "")
+}
@@ -0,0 +1,785 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// replacement for secret values in all output
+const secretMask = "******"
+
+// environment variable for the passphrase of encrypted secret files
+const secretsPassphraseEnv = "ZEUS_SECRETS_PASSPHRASE"
+
+// iterations for deriving the key of encrypted secret files
+const secretsKDFIterations = 600000
+
+// secrets are referenced in globals and arguments as ${secret:name}
+const secretPrefix = "secret:"
+
+var secretRegex = regexp.MustCompile(`\$\{` + secretPrefix + `([A-Za-z0-9_.-]+)\}`)
+
+// secretData is an entry of the secrets section of the commandsFile
+type secretData struct {
+
+	// file, pass, gpg or exec
+	Provider string `yaml:"provider"`
+
+	// entry for pass, encrypted file for gpg
+	Path string `yaml:"path"`
+
+	// shell command for exec, the value is read from stdout
+	Command string `yaml:"command"`
+
+	// encrypted secrets file for the file provider, defaults to zeus/secrets.enc
+	File string `yaml:"file"`
+
+	// key in the encrypted secrets file, defaults to the name of the secret
+	Key string `yaml:"key"`
+}
+
+// secretProvider resolves the value of a secret
+type secretProvider interface {
+
+	// check the required fields of the secret
+	validate(d *secretData) error
+
+	// retrieve the value
+	resolve(name string, d *secretData) (string, error)
+}
+
+// available secret providers
+var secretProviders = map[string]secretProvider{
+	"file": &fileSecretProvider{},
+	"pass": &passSecretProvider{},
+	"gpg":  &gpgSecretProvider{},
+	"exec": &execSecretProvider{},
+}
+
+// secretStore contains the declared secrets and the values resolved so far
+type secretStore struct {
+	items  map[string]*secretData
+	values map[string]string
+	sync.Mutex
+}
+
+func newSecretStore() *secretStore {
+	return &secretStore{
+		items:  make(map[string]*secretData),
+		values: make(map[string]string),
+	}
+}
+
+var (
+	// declared secrets
+	secrets = newSecretStore()
+
+	// all values that have been resolved and must be masked
+	// kept when the commandsFile is parsed again, since the values might still appear in the output
+	secretValues      = make(map[string]bool)
+	secretValuesMutex sync.RWMutex
+)
+
+// add the secrets of a commandsFile
+func (st *secretStore) add(items map[string]*secretData) error {
+
+	st.Lock()
+	defer st.Unlock()
+
+	for name, d := range items {
+		if d == nil {
+			return errors.New("invalid secret " + name + ": missing provider")
+		}
+		p, ok := secretProviders[d.Provider]
+		if !ok {
+			return errors.New("invalid secret " + name + ": unknown provider " + d.Provider + ", expected one of: file, pass, gpg, exec")
+		}
+		if err := p.validate(d); err != nil {
+			return errors.New("invalid secret " + name + ": " + err.Error())
+		}
+
+		// the cached value is dropped if the declaration changed
+		if prev, ok := st.items[name]; !ok || *prev != *d {
+			delete(st.values, name)
+		}
+		st.items[name] = d
+	}
+
+	return nil
+}
+
+// remove all declared secrets before the commandsFile is parsed again
+// resolved values are kept, so unchanged secrets are not retrieved again
+func (st *secretStore) reset() {
+	st.Lock()
+	st.items = make(map[string]*secretData)
+	st.Unlock()
+}
+
+// get the value of a secret, it is only retrieved from its provider once
+func (st *secretStore) get(name string) (string, error) {
+
+	st.Lock()
+	defer st.Unlock()
+
+	d, ok := st.items[name]
+	if !ok {
+		return "", errors.New("unknown secret: " + name)
+	}
+
+	if v, ok := st.values[name]; ok {
+		return v, nil
+	}
+
+	v, err := secretProviders[d.Provider].resolve(name, d)
+	if err != nil {
+		return "", errors.New("failed to resolve secret " + name + ": " + err.Error())
+	}
+
+	st.values[name] = v
+	addSecretValue(v)
+
+	return v, nil
+}
+
+// replace references to secrets in the format ${secret:name} with their values
+func resolveSecrets(input string) (string, error) {
+
+	var err error
+	out := secretRegex.ReplaceAllStringFunc(input, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		var v string
+		v, err = secrets.get(secretRegex.FindStringSubmatch(ref)[1])
+		return v
+	})
+
+	return out, err
+}
+
+// register a value that must be masked
+func addSecretValue(v string) {
+
+	if v == "" {
+		return
+	}
+
+	secretValuesMutex.Lock()
+	secretValues[v] = true
+	secretValuesMutex.Unlock()
+}
+
+// replace all secret values in the input
+func maskSecrets(input string) string {
+
+	secretValuesMutex.RLock()
+	defer secretValuesMutex.RUnlock()
+
+	if len(secretValues) == 0 {
+		return input
+	}
+
+	// longer values first, in case a value contains another one
+	var values []string
+	for v := range secretValues {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	for _, v := range values {
+		input = strings.ReplaceAll(input, v, secretMask)
+	}
+
+	return input
+}
+
+// mask the secret values in a map of arguments
+// returns a copy, so the original values can still be used
+func maskSecretArgs(args map[string]string) map[string]string {
+
+	if args == nil {
+		return nil
+	}
+
+	masked := make(map[string]string, len(args))
+	for k, v := range args {
+		masked[k] = maskSecrets(v)
+	}
+
+	return masked
+}
+
+// mask the secret values in a list of arguments
+// returns a copy, so the original values can still be used
+func maskSecretList(args []string) []string {
+
+	if args == nil {
+		return nil
+	}
+
+	masked := make([]string, len(args))
+	for i, v := range args {
+		masked[i] = maskSecrets(v)
+	}
+
+	return masked
+}
+
+// maskSecretsHook masks secret values in all log messages
+type maskSecretsHook struct{}
+
+// Levels implements the logrus.Hook interface
+func (maskSecretsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements the logrus.Hook interface
+func (maskSecretsHook) Fire(e *logrus.Entry) error {
+
+	e.Message = maskSecrets(e.Message)
+
+	for k, v := range e.Data {
+		e.Data[k] = maskSecretValue(v)
+	}
+
+	return nil
+}
+
+// mask secrets in a value of a log field
+func maskSecretValue(v interface{}) interface{} {
+
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return maskSecrets(val)
+	case error:
+		return maskSecrets(val.Error())
+	case fmt.Stringer:
+		return maskSecrets(val.String())
+	case []string:
+		masked := make([]string, len(val))
+		for i, s := range val {
+			masked[i] = maskSecrets(s)
+		}
+		return masked
+	case map[string]string:
+		return maskSecretArgs(val)
+	case []interface{}:
+		masked := make([]interface{}, len(val))
+		for i, s := range val {
+			masked[i] = maskSecretValue(s)
+		}
+		return masked
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(val))
+		for k, s := range val {
+			masked[k] = maskSecretValue(s)
+		}
+		return masked
+	}
+
+	// other types are only replaced by their string form if they contain a secret
+	if s := fmt.Sprint(v); maskSecrets(s) != s {
+		return maskSecrets(s)
+	}
+	return v
+}
+
+/*
+ *	Providers
+ */
+
+// execSecretProvider reads the value from the stdout of a shell command
+type execSecretProvider struct{}
+
+func (*execSecretProvider) validate(d *secretData) error {
+	if d.Command == "" {
+		return errors.New("the exec provider requires a command")
+	}
+	return nil
+}
+
+func (*execSecretProvider) resolve(name string, d *secretData) (string, error) {
+	return secretCommandOutput(exec.Command("/bin/sh", "-c", d.Command))
+}
+
+// passSecretProvider reads the first line of an entry of the pass password store
+type passSecretProvider struct{}
+
+func (*passSecretProvider) validate(d *secretData) error {
+	if d.Path == "" {
+		return errors.New("the pass provider requires a path")
+	}
+	return nil
+}
+
+func (*passSecretProvider) resolve(name string, d *secretData) (string, error) {
+	out, err := secretCommandOutput(exec.Command("pass", "show", d.Path))
+	if err != nil {
+		return "", err
+	}
+	return strings.SplitN(out, "\n", 2)[0], nil
+}
+
+// gpgSecretProvider decrypts a file with gpg
+type gpgSecretProvider struct{}
+
+func (*gpgSecretProvider) validate(d *secretData) error {
+	if d.Path == "" {
+		return errors.New("the gpg provider requires a path")
+	}
+	return nil
+}
+
+func (*gpgSecretProvider) resolve(name string, d *secretData) (string, error) {
+	return secretCommandOutput(exec.Command("gpg", "--quiet", "--batch", "--decrypt", d.Path))
+}
+
+// run a command and return its output without the trailing newline
+// stdin and stderr are passed through, so the user can be asked for a passphrase
+func secretCommandOutput(cmd *exec.Cmd) (string, error) {
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// fileSecretProvider reads the value from an encrypted secrets file
+type fileSecretProvider struct{}
+
+func (*fileSecretProvider) validate(d *secretData) error {
+	return nil
+}
+
+func (*fileSecretProvider) resolve(name string, d *secretData) (string, error) {
+
+	f, err := unlockSecretsFile(d.File)
+	if err != nil {
+		return "", err
+	}
+
+	key := d.Key
+	if key == "" {
+		key = name
+	}
+
+	v, ok := f.values[key]
+	if !ok {
+		return "", errors.New("key " + key + " not found in " + f.path)
+	}
+
+	return v, nil
+}
+
+/*
+ *	Encrypted Secrets File
+ */
+
+// default path of the encrypted secrets file
+func defaultSecretsFile() string {
+	return zeusDir + "/secrets.enc"
+}
+
+// encryptedSecrets is the format of the encrypted secrets file
+// the values are encrypted with AES-GCM, using a key derived from the passphrase with PBKDF2
+type encryptedSecrets struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// secretsFile is an unlocked secrets file
+type secretsFile struct {
+	path       string
+	passphrase string
+	values     map[string]string
+}
+
+// unlocked secrets files by path
+var (
+	secretsFiles      = make(map[string]*secretsFile)
+	secretsFilesMutex sync.Mutex
+)
+
+// unlock a secrets file, the passphrase is only requested once
+func unlockSecretsFile(path string) (*secretsFile, error) {
+
+	if path == "" {
+		path = defaultSecretsFile()
+	}
+
+	secretsFilesMutex.Lock()
+	defer secretsFilesMutex.Unlock()
+
+	if f, ok := secretsFiles[path]; ok {
+		return f, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := secretsPassphrase("passphrase for " + path + ": ")
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := decryptSecrets(contents, passphrase)
+	if err != nil {
+		return nil, errors.New("failed to unlock " + path + ": " + err.Error())
+	}
+
+	f := &secretsFile{
+		path:       path,
+		passphrase: passphrase,
+		values:     values,
+	}
+	secretsFiles[path] = f
+
+	return f, nil
+}
+
+// get the passphrase from the environment or ask the user
+func secretsPassphrase(prompt string) (string, error) {
+
+	if p := os.Getenv(secretsPassphraseEnv); p != "" {
+		return p, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no passphrase: set " + secretsPassphraseEnv + " or run in a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(p), nil
+}
+
+// derive the key for a secrets file
+func secretsKey(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt the values of a secrets file
+func encryptSecrets(values map[string]string, passphrase string) ([]byte, error) {
+
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptedSecrets{
+		Version:    1,
+		Iterations: secretsKDFIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := secretsKey(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Data = aead.Seal(nil, e.Nonce, plain, nil)
+
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// decrypt the values of a secrets file
+func decryptSecrets(contents []byte, passphrase string) (map[string]string, error) {
+
+	var e encryptedSecrets
+	err := json.Unmarshal(contents, &e)
+	if err != nil {
+		return nil, errors.New("invalid secrets file: " + err.Error())
+	}
+	if e.Version != 1 {
+		return nil, errors.New("unsupported secrets file version")
+	}
+
+	aead, err := secretsKey(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid secrets file: invalid nonce")
+	}
+
+	plain, err := aead.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted file")
+	}
+
+	values := make(map[string]string)
+	err = json.Unmarshal(plain, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// write the values of an unlocked secrets file
+func (f *secretsFile) save() error {
+
+	contents, err := encryptSecrets(f.values, f.passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.path, contents, 0600)
+}
+
+/*
+ *	Builtin
+ */
+
+func printSecretsUsageErr() {
+	l.Println(ErrInvalidUsage)
+	l.Println("usage: secrets [set <key> | remove <key>] [file=<path>]")
+}
+
+// handle the secrets builtin
+func handleSecretsCommand(args []string) {
+
+	var (
+		path   = defaultSecretsFile()
+		params []string
+	)
+	for _, a := range args {
+		if strings.HasPrefix(a, "file=") {
+			path = strings.TrimPrefix(a, "file=")
+			continue
+		}
+		params = append(params, a)
+	}
+
+	if len(params) == 0 {
+		printSecrets()
+		return
+	}
+
+	if len(params) != 2 {
+		printSecretsUsageErr()
+		return
+	}
+
+	switch params[0] {
+	case "set":
+		f, err := openSecretsFile(path)
+		if err != nil {
+			l.Println(err)
+			return
+		}
+		v, err := readSecretValue("value for " + params[1] + ": ")
+		if err != nil {
+			l.Println(err)
+			return
+		}
+		f.values[params[1]] = v
+		addSecretValue(v)
+		if err := f.save(); err != nil {
+			l.Println("failed to save secrets:", err)
+			return
+		}
+		l.Println("stored " + params[1] + " in " + path)
+	case "remove":
+		f, err := openSecretsFile(path)
+		if err != nil {
+			l.Println(err)
+			return
+		}
+		if _, ok := f.values[params[1]]; !ok {
+			l.Println("unknown key: " + params[1])
+			return
+		}
+		delete(f.values, params[1])
+		if err := f.save(); err != nil {
+			l.Println("failed to save secrets:", err)
+			return
+		}
+		l.Println("removed " + params[1] + " from " + path)
+	default:
+		printSecretsUsageErr()
+	}
+}
+
+// print the declared secrets, without their values
+func printSecrets() {
+
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	if len(secrets.items) == 0 {
+		l.Println("no secrets defined.")
+		return
+	}
+
+	var names []string
+	for name := range secrets.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := 20
+	l.Println("\n" + cp.Prompt + pad("name", w) + pad("provider", 10) + pad("status", 12) + "source")
+	for _, name := range names {
+
+		var (
+			d      = secrets.items[name]
+			status = "locked"
+			source string
+		)
+		if _, ok := secrets.values[name]; ok {
+			status = "resolved"
+		}
+
+		switch d.Provider {
+		case "file":
+			source = d.File
+			if source == "" {
+				source = defaultSecretsFile()
+			}
+			if d.Key != "" {
+				source += " (" + d.Key + ")"
+			}
+		case "exec":
+			source = d.Command
+		default:
+			source = d.Path
+		}
+
+		l.Println(cp.Text + pad(name, w) + pad(d.Provider, 10) + pad(status, 12) + source)
+	}
+}
+
+// open a secrets file for modification, it is created if it does not exist
+func openSecretsFile(path string) (*secretsFile, error) {
+
+	if _, err := os.Stat(path); err == nil {
+		return unlockSecretsFile(path)
+	}
+
+	passphrase, err := secretsPassphrase("new passphrase for " + path + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv(secretsPassphraseEnv) == "" {
+		repeated, err := secretsPassphrase("repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if repeated != passphrase {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	f := &secretsFile{
+		path:       path,
+		passphrase: passphrase,
+		values:     make(map[string]string),
+	}
+
+	secretsFilesMutex.Lock()
+	secretsFiles[path] = f
+	secretsFilesMutex.Unlock()
+
+	return f, nil
+}
+
+// read the value of a secret without echoing it
+// if stdin is not a terminal, the first line is read
+func readSecretValue(prompt string) (string, error) {
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	v, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(v), nil
+}
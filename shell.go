@@ -238,6 +238,14 @@ func handleLine(line string) {
 			handleTodoCommand(args)
 		case generateCommand:
 			handleGenerateCommand(args)
+		case graphCommand:
+			handleGraphCommand(args)
+		case explainCommand:
+			handleExplainCommand(args)
+		case reportCommand:
+			handleReportCommand(args)
+		case secretsCommand:
+			handleSecretsCommand(args[1:])
 
 		default:
 			// check if its a commandChain
@@ -245,7 +253,7 @@ func handleLine(line string) {
 				fields := strings.Split(line, commandChainSeparator)
 				if cmdChain, ok := validCommandChain(fields, false); ok {
 					shellBusy = true
-					cmdChain.exec(fields)
+					cmdChain.exec(fields, shellPrompt())
 					shellBusy = false
 				} else {
 					l.Println("invalid commandChain")
@@ -290,19 +298,21 @@ func handleLine(line string) {
 			cmdMap.Unlock()
 
 			defer s.reset()
-			count, err := getTotalDependencyCount(cmd)
+
+			// ask for missing arguments
+			args, err := cmd.promptMissingArgs(args)
 			if err != nil {
 				l.Println(err)
 				return
 			}
 
-			s.Lock()
-			s.numCommands = s.numCommands + count
-			s.Unlock()
-
 			// run the command
 			shellBusy = true
-			err = cmd.Run(args, cmd.async)
+			if cmd.async {
+				err = cmd.Run(args, true)
+			} else {
+				err = cmd.run(args, shellPrompt())
+			}
 			if err != nil {
 				if err.Error() == "signal: interrupt" {
 					fmt.Println(" " + err.Error())
@@ -0,0 +1,471 @@
+/*
+ *  ZEUS - An Electrifying Build System
+ *  Copyright (c) 2017 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// number of bytes of output kept in memory for each detached process
+	outputBufferSize = 64 * 1024
+
+	// number of chunks queued for a subscriber before output is dropped
+	// followers read the dropped output from the log file
+	subscriberQueueSize = 256
+)
+
+// logChunk is a piece of output and its offset in the log file
+type logChunk struct {
+	offset int64
+	data   []byte
+}
+
+// outputBuffer captures the combined output of a detached process.
+// the most recent output is kept in memory, the complete output is written to a log file
+// and copied to all subscribers
+type outputBuffer struct {
+	sync.Mutex
+
+	data        []byte
+	written     int64
+	file        *os.File
+	subscribers map[chan logChunk]struct{}
+	closed      bool
+}
+
+// path of the log file for a detached process
+func processLogPath(name string, id processID) string {
+	return zeusDir + "/logs/" + name + "_" + string(id) + ".log"
+}
+
+// create an outputBuffer that writes to the log file at path
+func newOutputBuffer(path string) (*outputBuffer, error) {
+
+	err := os.MkdirAll(zeusDir+"/logs", 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &outputBuffer{
+		file:        f,
+		subscribers: make(map[chan logChunk]struct{}),
+	}, nil
+}
+
+// Write implements the io.Writer interface
+func (b *outputBuffer) Write(p []byte) (int, error) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	offset := b.written
+	if b.file != nil {
+		n, err := b.file.Write(p)
+		if err != nil {
+			Log.WithError(err).Error("failed to write process log")
+		}
+		b.written += int64(n)
+	}
+
+	// discard the oldest output once the buffer is full
+	b.data = append(b.data, p...)
+	if len(b.data) > outputBufferSize {
+		b.data = append([]byte(nil), b.data[len(b.data)-outputBufferSize:]...)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- logChunk{offset: offset, data: append([]byte(nil), p...)}:
+		default:
+			// don't block the process if a subscriber is too slow
+			// the offset of the next chunk reveals the gap
+		}
+	}
+
+	return len(p), nil
+}
+
+// return a copy of the buffered output
+func (b *outputBuffer) Bytes() []byte {
+
+	b.Lock()
+	defer b.Unlock()
+
+	return append([]byte(nil), b.data...)
+}
+
+// subscribe to the output
+// returns the currently buffered output and a channel that receives all new output.
+// the channel is closed once the process has exited
+func (b *outputBuffer) subscribe() ([]byte, chan logChunk) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	ch := make(chan logChunk, subscriberQueueSize)
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+
+	return append([]byte(nil), b.data...), ch
+}
+
+// subscribe to the output
+// returns the number of bytes written to the log file so far
+// and a channel that receives all new output.
+// chunks are dropped if the subscriber is too slow, they can be read from the log file.
+// the channel is closed once the process has exited
+func (b *outputBuffer) subscribeLog() (int64, chan logChunk) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	ch := make(chan logChunk, subscriberQueueSize)
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+
+	return b.written, ch
+}
+
+// remove a subscriber
+func (b *outputBuffer) unsubscribe(ch chan logChunk) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close the log file and all subscriber channels
+func (b *outputBuffer) close() {
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+
+	if b.file != nil {
+		if err := b.file.Close(); err != nil {
+			Log.WithError(err).Error("failed to close process log")
+		}
+	}
+}
+
+// restart policies for detached commands
+const (
+	restartAlways    = "always"
+	restartOnFailure = "on-failure"
+)
+
+var (
+	// default delay before a detached command is restarted
+	// the delay doubles for every consecutive restart
+	defaultRestartDelay = time.Second
+
+	// upper limit for the restart delay
+	// a process that was running for longer than this resets the backoff
+	maxRestartDelay = time.Minute
+
+	// a notification is shown when a process is restarted this many times within restartNoteWindow,
+	// so processes that keep crashing are reported even without a restart limit
+	restartNoteThreshold = 5
+	restartNoteWindow    = time.Minute
+)
+
+// times of the recent restarts of a process
+type restartWindow []time.Time
+
+// record a restart at t
+// returns true if restartNoteThreshold restarts happened within restartNoteWindow.
+// the window is reset afterwards, so each burst of restarts is reported once
+func (w *restartWindow) add(t time.Time) bool {
+
+	recent := (*w)[:0]
+	for _, r := range *w {
+		if t.Sub(r) < restartNoteWindow {
+			recent = append(recent, r)
+		}
+	}
+	recent = append(recent, t)
+
+	if len(recent) >= restartNoteThreshold {
+		*w = recent[:0]
+		return true
+	}
+	*w = recent
+
+	return false
+}
+
+// wait for a detached process to exit and record its exit status
+// the result is emitted as an execution event.
+// depending on the restart policy of the command, the process is started again via respawn
+func (c *command) supervise(cmd *exec.Cmd, p *Process, ev executionEvent, cleanupFunc func(), start time.Time, respawn func() (*exec.Cmd, func(), error)) {
+
+	// the run that started the process has already been recorded
+	ev.record = nil
+
+	var (
+		consecutive int
+		recent      restartWindow
+	)
+
+	defer func() {
+		p.Output.close()
+		close(p.done)
+	}()
+
+	for {
+		err := cmd.Wait()
+		ev.Resources = resourceUsageOf(cmd.ProcessState)
+
+		// execute cleanupFunc if there is one
+		if cleanupFunc != nil {
+			cleanupFunc()
+		}
+
+		ev.Time = time.Now()
+		ev.DurationMS = durationMS(time.Since(start))
+		ev.Reason = ""
+
+		// processes stopped by the health check count as failed
+		processMapMutex.Lock()
+		unhealthy := p.unhealthy
+		p.unhealthy = false
+		processMapMutex.Unlock()
+		if unhealthy {
+			ev.Reason = healthUnhealthy
+			if err == nil {
+				err = errors.New(healthUnhealthy)
+			}
+		}
+
+		if err != nil {
+			ev.Type = eventFail
+			ev.ExitCode = exitCode(err)
+			ev.Error = err.Error()
+			ev.Stderr = tail(string(p.Output.Bytes()), stderrTailLines)
+		} else {
+			code := 0
+			ev.Type = eventFinish
+			ev.ExitCode = &code
+			ev.Error = ""
+			ev.Stderr = ""
+		}
+
+		processMapMutex.Lock()
+		p.Exited = true
+		p.ExitCode = ev.ExitCode
+		p.Err = ev.Error
+		status := p.status()
+		restarts := p.Restarts
+		stopped := p.Stopped
+		processMapMutex.Unlock()
+
+		emitEvent(&ev)
+
+		Log.Debug("detached process " + string(p.ID) + " with PID " + strconv.Itoa(ev.PID) + " " + status)
+
+		if stopped || !c.shouldRestart(err) {
+			return
+		}
+
+		if c.maxRestarts > 0 && restarts >= c.maxRestarts {
+			if !jsonLogFormat() {
+				l.Println(cp.Text + "giving up on " + cp.Prompt + c.name + cp.Text + " (ID: " + string(p.ID) + ") after " + strconv.Itoa(restarts) + " restarts, " + status + cp.Reset)
+			}
+			showNote("giving up on "+c.name, status+" after "+strconv.Itoa(restarts)+" restarts")
+			return
+		}
+
+		if recent.add(time.Now()) {
+			if !jsonLogFormat() {
+				l.Println(cp.Text + "process " + cp.Prompt + c.name + cp.Text + " (ID: " + string(p.ID) + ") restarted " + strconv.Itoa(restartNoteThreshold) + " times within " + restartNoteWindow.String() + cp.Reset)
+			}
+			showNote(c.name+" keeps restarting", strconv.Itoa(restartNoteThreshold)+" restarts within "+restartNoteWindow.String())
+		}
+
+		// reset the backoff for processes that were running for a while
+		if time.Since(start) > maxRestartDelay {
+			consecutive = 0
+		}
+		delay := c.restartBackoff(consecutive)
+		consecutive++
+
+		if !jsonLogFormat() {
+			l.Println(cp.Text + "restarting " + cp.Prompt + c.name + cp.Text + " (ID: " + string(p.ID) + ") in " + delay.String() + ", " + status + cp.Reset)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-p.stop:
+			return
+		}
+
+		cmd, cleanupFunc, err = respawn()
+		if err != nil {
+			Log.WithError(err).Error("failed to restart " + c.name)
+			return
+		}
+		start = time.Now()
+
+		processMapMutex.Lock()
+		p.Proc = cmd.Process
+		p.PID = cmd.Process.Pid
+		p.Started = start
+		p.Restarts++
+		p.Exited = false
+		p.ExitCode = nil
+		p.Err = ""
+		if c.healthCheck != nil {
+			p.Health = healthStarting
+		}
+		ev.Restarts = p.Restarts
+		processMapMutex.Unlock()
+
+		ev.Type = eventStart
+		ev.Time = time.Now()
+		ev.PID = cmd.Process.Pid
+		ev.DurationMS = 0
+		ev.ExitCode = nil
+		ev.Error = ""
+		ev.Stderr = ""
+		ev.Resources = nil
+		ev.Reason = "restart"
+		emitEvent(&ev)
+	}
+}
+
+// check if a detached command should be started again after it exited with the given error
+func (c *command) shouldRestart(err error) bool {
+	switch c.restart {
+	case restartAlways:
+		return true
+	case restartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+// delay before a restart, doubles with every consecutive restart
+func (c *command) restartBackoff(consecutive int) time.Duration {
+
+	delay := c.restartDelay
+	if delay == 0 {
+		delay = defaultRestartDelay
+	}
+
+	for i := 0; i < consecutive && delay < maxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	}
+
+	return delay
+}
+
+// stream the output of a detached process to stdout,
+// starting with the buffered output.
+// returns when the process exits or the user hits Ctrl-C
+func attachProcess(p *Process) {
+
+	backlog, ch := p.Output.subscribe()
+	defer p.Output.unsubscribe(ch)
+
+	os.Stdout.Write(backlog)
+
+	done, release := catchInterrupt()
+	defer release()
+
+	for {
+		select {
+		case b, ok := <-ch:
+			if !ok {
+				processMapMutex.Lock()
+				status := p.status()
+				processMapMutex.Unlock()
+
+				l.Println(cp.Text + "process " + string(p.ID) + " " + status + cp.Reset)
+				return
+			}
+			os.Stdout.Write(b.data)
+		case <-done:
+			l.Println()
+			return
+		}
+	}
+}
+
+// returns a channel that is closed when the user hits Ctrl-C
+// the shell stays open until release is called
+func catchInterrupt() (<-chan struct{}, func()) {
+
+	var (
+		sig  = make(chan os.Signal, 1)
+		done = make(chan struct{})
+		quit = make(chan struct{})
+	)
+	signal.Notify(sig, os.Interrupt)
+
+	// prevent the signal handler from exiting the shell
+	shellBusy = true
+
+	go func() {
+		select {
+		case <-sig:
+			close(done)
+		case <-quit:
+		}
+	}()
+
+	return done, func() {
+		signal.Stop(sig)
+		close(quit)
+		shellBusy = false
+	}
+}
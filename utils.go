@@ -29,7 +29,6 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -83,13 +82,13 @@ func dumpScript(script, language string, e error, stdErr string) {
 	}
 
 	var stdErrOutputComment string
-	for _, line := range strings.Split(stdErr, "\n") {
+	for _, line := range strings.Split(maskSecrets(stdErr), "\n") {
 		stdErrOutputComment += lang.Comment + " " + line + "\n"
 	}
 
 	var (
 		t            = lang.Comment + " Timestamp: " + time.Now().Format(timestampFormat) + "\n"
-		errString    = lang.Comment + " Error: " + e.Error() + "\n" + lang.Comment + " StdErr: \n" + stdErrOutputComment + "\n\n"
+		errString    = lang.Comment + " Error: " + maskSecrets(e.Error()) + "\n" + lang.Comment + " StdErr: \n" + stdErrOutputComment + "\n\n"
 		dumpFileName = pathZeusDir + "/dumps/error_dump" + lang.FileExtension
 	)
 
@@ -100,11 +99,12 @@ func dumpScript(script, language string, e error, stdErr string) {
 	}
 	defer fd.Close()
 
-	fd.WriteString(lang.Bang + "\n" + lang.Comment + "\n")
+	// the script comes first, so the line numbers in the error match the ones in the dump
+	fd.WriteString(maskSecrets(script))
+	fd.WriteString("\n\n" + lang.Comment + "\n")
 	fd.WriteString(lang.Comment + " ZEUS Error Dump\n")
 	fd.WriteString(t)
 	fd.WriteString(errString)
-	fd.WriteString(script)
 	Log.Debug("script dumped: ", dumpFileName)
 }
 
@@ -113,6 +113,8 @@ func dumpScript(script, language string, e error, stdErr string) {
 // when no line shall be highlighted pass -1
 func printScript(contents, path string, highlightLine int) {
 
+	contents = maskSecrets(contents)
+
 	fmt.Println("\n" + cp.Reset + " |---------------------------------------------------------------------------------------------|")
 	fmt.Println("     Script: " + path)
 	fmt.Println(" |---------------------------------------------------------------------------------------------|")
@@ -188,6 +190,71 @@ func printCodeSnippet(contents, path string, highlightLine int) {
 	fmt.Println(" |---------------------------------------------------------------------------------------------|" + cp.Text)
 }
 
+// find the line in which a command declares a dependency
+// returns the line number starting from 1, or -1 if the line could not be found
+func findDependencyLine(contents, name, dep string) int {
+
+	var (
+		commandStarted bool
+		indent         int
+	)
+
+	for i, line := range strings.Split(contents, "\n") {
+
+		trimmed := strings.TrimSpace(line)
+
+		if !commandStarted {
+			if trimmed == name+":" {
+				commandStarted = true
+				indent = countLeadingSpace(line)
+			}
+			continue
+		}
+
+		// reached the next command
+		if trimmed != "" && countLeadingSpace(line) <= indent {
+			break
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			fields := strings.Fields(strings.TrimPrefix(trimmed, "-"))
+			if len(fields) > 0 && fields[0] == dep {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// find the line of a global declaration in the commandsFile contents
+// returns -1 if the line could not be found
+func findGlobalLine(contents, key string) int {
+
+	var globalsStarted bool
+
+	for i, line := range strings.Split(contents, "\n") {
+
+		trimmed := strings.TrimSpace(line)
+
+		if !globalsStarted {
+			globalsStarted = trimmed == "globals:" && countLeadingSpace(line) == 0
+			continue
+		}
+
+		// reached the next section
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && countLeadingSpace(line) == 0 {
+			break
+		}
+
+		if strings.HasPrefix(trimmed, key+":") {
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
 // handle OS SIGNALS for a clean exit and clean up all spawned processes
 func handleSignals(cmdFile *CommandsFile) {
 
@@ -285,49 +352,6 @@ func extractLineNumFromError(errMsg, errLineNumberSymbol string) (int, error) {
 	return 0, ErrNoLineNumberFound
 }
 
-// count total length of the commands dependencies
-func countDependencies(deps []string) (int, error) {
-
-	if len(deps) == 0 {
-		return 0, nil
-	}
-
-	count := 0
-	for _, dep := range deps {
-
-		fields := strings.Fields(dep)
-		if len(fields) == 0 {
-			return 0, ErrEmptyDependency
-		}
-
-		// lookup
-		cmd, err := cmdMap.getCommand(fields[0])
-		if err != nil {
-			return 0, errors.New("invalid dependency: " + err.Error())
-		}
-
-		err = s.incrementRecursionCount(cmd.name)
-		if err != nil {
-			return 0, err
-		}
-
-		count++
-		if len(cmd.dependencies) > 0 {
-			c, err := countDependencies(cmd.dependencies)
-			if err != nil {
-				return 0, err
-			}
-			count += c
-		}
-	}
-	return count, nil
-}
-
-func getTotalDependencyCount(c *command) (int, error) {
-	count, err := countDependencies(c.dependencies)
-	return count + 1, err
-}
-
 // print the prompt for the interactive shell
 func printPrompt() string {
 	return cp.Prompt + zeusPrompt + " » " + cp.Text
@@ -407,6 +431,11 @@ func handleHelpCommand(args []string) {
 
 	if c, ok := cmdMap.items[args[1]]; ok {
 
+		if len(c.args) > 0 {
+			l.Println("\nusage: " + argUsage(c.name, c.args))
+			l.Println("values can also be passed as label=value, --label=value or --label value")
+		}
+
 		if c.help != "" {
 			l.Println("\n" + c.help)
 		} else {
@@ -423,51 +452,6 @@ func printHelpUsageErr() {
 	l.Println("usage: help <command>")
 }
 
-// check if the argument type matches the expected one
-func validArgType(in string, k reflect.Kind) error {
-
-	var err error
-
-	switch k {
-	case reflect.Bool:
-		_, err = strconv.ParseBool(in)
-	case reflect.Int:
-		_, err = strconv.ParseInt(in, 10, 0)
-	case reflect.Float64:
-		_, err = strconv.ParseFloat(in, 10)
-	case reflect.String:
-
-		// check if input is explicitely marked as string
-		if strings.HasPrefix(in, "\"") && strings.HasSuffix(in, "\"") {
-			return nil
-		} else if strings.HasPrefix(in, "'") && strings.HasSuffix(in, "'") {
-			return nil
-		}
-
-		// you could pass everything as a string
-		// so lets check if its not something else...
-		_, err = strconv.ParseBool(in)
-		if err == nil {
-			return errors.New("got bool but want string")
-		}
-		_, err = strconv.ParseInt(in, 10, 0)
-		if err == nil {
-			return errors.New("got int but want string")
-		}
-		_, err = strconv.ParseFloat(in, 10)
-		if err == nil {
-			return errors.New("got float but want string")
-		}
-
-		// all good
-		return nil
-	default:
-		return errors.New("recevied unknown type")
-	}
-
-	return err
-}
-
 // display an OS notification
 func showNote(text, subtitle string) {
 	err := beeep.Notify("ZEUS", text+":"+subtitle, "")
@@ -74,9 +74,7 @@ var (
 	// shell formatter
 	f = newFormatter("path/to/your/formatter", bashLanguage())
 
-	g = &globals{
-		Vars: make(map[string]string, 0),
-	}
+	g = newGlobals()
 
 	debug        bool
 	asciiArt     string
@@ -84,14 +82,19 @@ var (
 	workingDir   string
 
 	// status info
-	s = &status{
-		recursionMap: make(map[string]int, 0),
-	}
+	s = &status{}
 
 	// running a test?
 	testingMode bool
 
 	promptFilePath = "zeus/.zeus_prompt"
+
+	// maximum number of commands to execute in parallel, set via the -j flag
+	// overrides the maxParallel config field if set
+	parallelFlag int
+
+	// print the execution plan instead of executing, set via the --dry-run flag
+	dryRunFlag bool
 )
 
 type atomicLogger struct {
@@ -100,8 +103,14 @@ type atomicLogger struct {
 }
 
 func newAtomicLogger() *atomicLogger {
+
+	logger := logrus.New()
+
+	// secret values are masked in all log messages
+	logger.AddHook(maskSecretsHook{})
+
 	return &atomicLogger{
-		logrus.New(),
+		logger,
 		sync.RWMutex{},
 	}
 }
@@ -113,6 +122,9 @@ func initZeus() {
 		flagCompletions = flag.String("completions", "", "get available command completions")
 		flagWorkDir     = flag.String("C", "", "set work directory to start from")
 		flagHelp        = flag.Bool("h", false, "print zeus help and exit")
+		flagParallel    = flag.Int("j", 0, "maximum number of commands to execute in parallel")
+		flagDryRun      = flag.Bool("dry-run", false, "print the execution plan of a command without executing it")
+		flagLogFormat   = flag.String("log-format", "", "format for the command lifecycle output: text or json")
 	)
 
 	// set up formatter
@@ -144,6 +156,14 @@ func initZeus() {
 
 	flag.Parse()
 
+	parallelFlag = *flagParallel
+	dryRunFlag = *flagDryRun
+	logFormatFlag = *flagLogFormat
+
+	if err := validateLogFormat(logFormatFlag); err != nil {
+		log.Fatal(err)
+	}
+
 	if *flagWorkDir != "" {
 		if strings.HasPrefix(*flagWorkDir, "~") {
 			usr, err := user.Current()
@@ -413,18 +433,7 @@ func printProjectHeader() {
 func handleArgs(args []string, cmdFile *CommandsFile) {
 
 	// strip commandline flags
-	for i, elem := range args {
-		if strings.HasPrefix(elem, "-C=") {
-			// delete i
-			args = append(args[:i], args[i+1:]...)
-			break
-		}
-		if elem == "-C" {
-			// delete i and i+1
-			args = append(args[:i], args[i+2:]...)
-			break
-		}
-	}
+	args = stripFlags(args)
 
 	var cLog = Log.WithField("prefix", "handleArgs")
 
@@ -480,12 +489,33 @@ func handleArgs(args []string, cmdFile *CommandsFile) {
 			handleMakefileCommand(args[1:])
 		case gitFilterCommand:
 			handleGitFilterCommand(args[1:])
+		case graphCommand:
+			handleGraphCommand(args[1:])
+		case explainCommand:
+			handleExplainCommand(args[1:])
+		case reportCommand:
+			handleReportCommand(args[1:])
+		case secretsCommand:
+			handleSecretsCommand(args[2:])
 
 		case createCommand:
 			handleCreateCommand(args[1:])
 			os.Exit(0)
 
 		default:
+			// print the execution plan instead of executing anything
+			if dryRunFlag {
+				err := explain(strings.Join(args[1:], " "))
+				if err != nil {
+					cLog.WithError(err).Error("failed to explain " + strings.Join(args[1:], " "))
+					os.Exit(1)
+				}
+				if !testingMode {
+					os.Exit(0)
+				}
+				return
+			}
+
 			handleSignals(cmdFile)
 			cmdMap.Lock()
 
@@ -495,18 +525,8 @@ func handleArgs(args []string, cmdFile *CommandsFile) {
 
 				validCommand = true
 
-				count, err := getTotalDependencyCount(cmd)
-				if err != nil {
-					l.Println(err)
-					return
-				}
-
-				s.Lock()
-				s.numCommands = count
-				s.Unlock()
-
 				shellBusy = true
-				err = cmd.Run(args[2:], cmd.async)
+				err := cmd.Run(args[2:], cmd.async)
 				if err != nil {
 					cLog.WithError(err).Error("failed to execute " + cmd.name)
 					cleanup(cmdFile)
@@ -522,7 +542,7 @@ func handleArgs(args []string, cmdFile *CommandsFile) {
 				fields := strings.Split(args[1], commandChainSeparator)
 				if cmdChain, ok := validCommandChain(fields, false); ok {
 					shellBusy = true
-					cmdChain.exec(fields)
+					cmdChain.exec(fields, nil)
 					shellBusy = false
 				} else {
 					l.Println("invalid commandChain")
@@ -547,3 +567,31 @@ func handleArgs(args []string, cmdFile *CommandsFile) {
 		}
 	}
 }
+
+// remove the zeus commandline flags and their values from the arguments
+// flags are only accepted prior to the command name
+func stripFlags(args []string) []string {
+
+	if len(args) == 0 {
+		return args
+	}
+
+	var (
+		stripped = []string{args[0]}
+		i        = 1
+	)
+
+	for ; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		switch args[i] {
+		case "-C", "--C", "-j", "--j", "-log-format", "--log-format":
+			// skip the value as well
+			i++
+		}
+	}
+
+	if i < len(args) {
+		stripped = append(stripped, args[i:]...)
+	}
+
+	return stripped
+}
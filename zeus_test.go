@@ -19,11 +19,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -411,6 +425,1700 @@ func TestDependencies(t *testing.T) {
 	})
 }
 
+func TestInputs(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing up-to-date checks with inputs", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("inputs")
+		c.So(err, ShouldBeNil)
+
+		err = ioutil.WriteFile("tests/bin/inputs.src", []byte("v1"), 0700)
+		c.So(err, ShouldBeNil)
+
+		// output does not exist yet
+		ok, _, _, err := cmd.upToDate(map[string]string{}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeFalse)
+
+		handleLine("inputs")
+		_, err = os.Stat("tests/bin/inputs")
+		c.So(err, ShouldBeNil)
+
+		// nothing changed since the last run
+		ok, _, _, err = cmd.upToDate(map[string]string{}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeTrue)
+
+		// modify the input
+		err = ioutil.WriteFile("tests/bin/inputs.src", []byte("v2"), 0700)
+		c.So(err, ShouldBeNil)
+
+		ok, _, reason, err := cmd.upToDate(map[string]string{}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeFalse)
+		c.So(reason, ShouldContainSubstring, "changed")
+
+		// passthrough arguments are part of the invocation
+		cmd, err = cmdMap.getCommand("passthrough-outputs")
+		c.So(err, ShouldBeNil)
+
+		dg := newDepGraph()
+		_, err = dg.addRoot(cmd, []string{})
+		c.So(err, ShouldBeNil)
+		_, err = dg.addRoot(cmd, []string{"--", "x"})
+		c.So(err, ShouldBeNil)
+		c.So(dg.nodes, ShouldHaveLength, 2)
+		c.So(dg.nodes[1].label, ShouldEqual, "passthrough-outputs -- x")
+
+		c.So(cmd.Run([]string{}, false), ShouldBeNil)
+		c.So(cmd.Run([]string{"--", "x"}, false), ShouldBeNil)
+		c.So(cmd.Run([]string{"--", "x"}, false), ShouldBeNil)
+		contents, err := ioutil.ReadFile("tests/bin/passthrough")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "run \nrun x\n")
+
+		// clean up
+		os.Remove("tests/bin/inputs")
+		os.Remove("tests/bin/inputs.src")
+		os.Remove("tests/bin/passthrough")
+		os.Remove("tests/zeus/hashes.yml")
+	})
+}
+
+func TestRetriesAndTimeout(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing retries and timeouts", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("retry")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.retries, ShouldEqual, 2)
+		c.So(cmd.retryDelay, ShouldEqual, 10*time.Millisecond)
+
+		// the first attempt fails, the second succeeds
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+		_, err = os.Stat("tests/bin/retry")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		cmd, err = cmdMap.getCommand("timeout")
+		c.So(err, ShouldBeNil)
+
+		start := time.Now()
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "timeout after 200ms")
+		c.So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+}
+
+func TestSupervisor(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the supervisor for detached commands", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("async-exit")
+		c.So(err, ShouldBeNil)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p := findProcess("async-exit")
+		c.So(p, ShouldNotBeNil)
+		c.So(p.Async, ShouldBeTrue)
+
+		// wait for the process to exit
+		for i := 0; i < 50; i++ {
+			processMapMutex.Lock()
+			exited := p.Exited
+			processMapMutex.Unlock()
+			if exited {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		processMapMutex.Lock()
+		c.So(p.Exited, ShouldBeTrue)
+		c.So(*p.ExitCode, ShouldEqual, 3)
+		c.So(p.status(), ShouldEqual, "exited (3)")
+		processMapMutex.Unlock()
+
+		c.So(string(p.Output.Bytes()), ShouldEqual, "detached output\n")
+
+		contents, err := ioutil.ReadFile(processLogPath(p.Name, p.ID))
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "detached output\n")
+
+		// subscribing to an exited process returns the buffered output
+		backlog, ch := p.Output.subscribe()
+		c.So(string(backlog), ShouldEqual, "detached output\n")
+		_, ok := <-ch
+		c.So(ok, ShouldBeFalse)
+
+		handleProcsCommand([]string{"procs", "kill", string(p.ID)})
+		c.So(findProcess(string(p.ID)), ShouldBeNil)
+
+		os.RemoveAll(zeusDir + "/logs")
+	})
+}
+
+func TestRestartsAndHealthChecks(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing restart policies and health checks", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("async-restart")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.restart, ShouldEqual, restartOnFailure)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		// the supervisor gives up after the maximum number of restarts
+		p := findProcess("async-restart")
+		c.So(p, ShouldNotBeNil)
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+		}
+
+		processMapMutex.Lock()
+		c.So(p.Restarts, ShouldEqual, 2)
+		c.So(p.status(), ShouldEqual, "exited (1)")
+		processMapMutex.Unlock()
+		c.So(string(p.Output.Bytes()), ShouldEqual, "run\nrun\nrun\n")
+
+		handleProcsCommand([]string{"procs", "kill", string(p.ID)})
+
+		// backoff doubles up to the maximum delay
+		c.So(cmd.restartBackoff(0), ShouldEqual, 10*time.Millisecond)
+		c.So(cmd.restartBackoff(2), ShouldEqual, 40*time.Millisecond)
+		c.So(cmd.restartBackoff(100), ShouldEqual, maxRestartDelay)
+
+		// repeated restarts within the window are reported once per burst
+		var w restartWindow
+		now := time.Now()
+		for i := 1; i < restartNoteThreshold; i++ {
+			c.So(w.add(now.Add(time.Duration(i)*time.Second)), ShouldBeFalse)
+		}
+		c.So(w.add(now.Add(time.Duration(restartNoteThreshold)*time.Second)), ShouldBeTrue)
+		c.So(w, ShouldBeEmpty)
+
+		// restarts outside of the window are not counted
+		for i := 0; i < restartNoteThreshold*2; i++ {
+			c.So(w.add(now.Add(time.Duration(i)*restartNoteWindow)), ShouldBeFalse)
+		}
+		c.So(len(w), ShouldEqual, 1)
+
+		cmd, err = cmdMap.getCommand("async-health")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.healthCheck, ShouldNotBeNil)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p = findProcess("async-health")
+		c.So(p, ShouldNotBeNil)
+
+		var health string
+		for i := 0; i < 50 && health != healthHealthy; i++ {
+			time.Sleep(50 * time.Millisecond)
+			processMapMutex.Lock()
+			health = p.Health
+			processMapMutex.Unlock()
+		}
+		c.So(health, ShouldEqual, healthHealthy)
+
+		// killed processes are not restarted
+		handleProcsCommand([]string{"procs", "kill", string(p.ID)})
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+		}
+		processMapMutex.Lock()
+		c.So(p.Stopped, ShouldBeTrue)
+		c.So(p.Restarts, ShouldEqual, 0)
+		processMapMutex.Unlock()
+
+		// unhealthy processes are restarted according to the restart policy
+		cmd, err = cmdMap.getCommand("async-unhealthy")
+		c.So(err, ShouldBeNil)
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p = findProcess("async-unhealthy")
+		c.So(p, ShouldNotBeNil)
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+		}
+
+		processMapMutex.Lock()
+		c.So(p.Restarts, ShouldEqual, 2)
+		c.So(p.Health, ShouldEqual, healthUnhealthy)
+		c.So(p.Err, ShouldEqual, "signal: terminated")
+		processMapMutex.Unlock()
+		c.So(string(p.Output.Bytes()), ShouldEqual, "run\nrun\nrun\n")
+		handleProcsCommand([]string{"procs", "kill", string(p.ID)})
+
+		// tcp checks
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+		hc := &healthCheck{tcp: ln.Addr().String(), interval: time.Second}
+		c.So(hc.check(""), ShouldBeNil)
+		ln.Close()
+		c.So(hc.check(""), ShouldNotBeNil)
+
+		// invalid configurations
+		_, err = (&healthCheckData{}).init("test")
+		c.So(err, ShouldNotBeNil)
+		_, err = (&healthCheckData{TCP: "localhost:80", HTTP: "http://localhost"}).init("test")
+		c.So(err, ShouldNotBeNil)
+
+		os.RemoveAll(zeusDir + "/logs")
+	})
+}
+
+func TestProcessLogs(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the logs of detached processes", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("async-logs")
+		c.So(err, ShouldBeNil)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p := findProcess("async-logs")
+		c.So(p, ShouldNotBeNil)
+
+		// follow until the process exits
+		var b bytes.Buffer
+		err = writeProcessLogs(&b, []*Process{p}, &logOptions{follow: true}, make(chan struct{}))
+		c.So(err, ShouldBeNil)
+		c.So(b.String(), ShouldEqual, "async-logs | one\nasync-logs | two\nasync-logs | three\n")
+
+		// tail and grep
+		b.Reset()
+		err = writeProcessLogs(&b, []*Process{p}, &logOptions{lines: 1}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(b.String(), ShouldEqual, "async-logs | three\n")
+
+		b.Reset()
+		err = writeProcessLogs(&b, []*Process{p}, &logOptions{grep: regexp.MustCompile("^t")}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(b.String(), ShouldEqual, "async-logs | two\nasync-logs | three\n")
+
+		// multiplexing aligns the prefixes
+		cmd, err = cmdMap.getCommand("async-exit")
+		c.So(err, ShouldBeNil)
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		exit := findProcess("async-exit")
+		c.So(exit, ShouldNotBeNil)
+		<-exit.done
+
+		b.Reset()
+		err = writeProcessLogs(&b, []*Process{exit, p}, &logOptions{grep: regexp.MustCompile("o")}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(b.String(), ShouldEqual, "async-exit | detached output\nasync-logs | one\nasync-logs | two\n")
+
+		// web panel
+		rec := httptest.NewRecorder()
+		procsLogsHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/procs/logs?proc=async-logs&n=2", nil))
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+		c.So(rec.Body.String(), ShouldEqual, "async-logs | two\nasync-logs | three\n")
+
+		rec = httptest.NewRecorder()
+		procsLogsHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/procs/logs?proc=unknown", nil))
+		c.So(rec.Code, ShouldEqual, http.StatusNotFound)
+
+		deleteProcess(p.ID)
+		deleteProcess(exit.ID)
+
+		// logs of processes that are no longer in the process list are read from disk
+		for _, key := range []string{"async-logs", string(p.ID)} {
+			procs, err := lookupLogProcesses([]string{key})
+			c.So(err, ShouldBeNil)
+			b.Reset()
+			err = writeProcessLogs(&b, procs, &logOptions{follow: true}, make(chan struct{}))
+			c.So(err, ShouldBeNil)
+			c.So(b.String(), ShouldEqual, "async-logs | one\nasync-logs | two\nasync-logs | three\n")
+		}
+
+		rec = httptest.NewRecorder()
+		procsLogsHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/procs/logs?proc=async-exit", nil))
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+		c.So(rec.Body.String(), ShouldEqual, "async-exit | detached output\n")
+
+		// output dropped for a slow follower is read from the log file
+		queueSize := subscriberQueueSize
+		subscriberQueueSize = 1
+
+		id := processID(randomString())
+		out, err := newOutputBuffer(processLogPath("slow", id))
+		c.So(err, ShouldBeNil)
+		slow := &Process{Name: "slow", ID: id, Async: true, Output: out}
+
+		pr, pw := io.Pipe()
+		go func() {
+			writeProcessLogs(pw, []*Process{slow}, &logOptions{follow: true}, make(chan struct{}))
+			pw.Close()
+		}()
+		for {
+			out.Lock()
+			n := len(out.subscribers)
+			out.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		var expected string
+		for i := 0; i < 100; i++ {
+			line := strconv.Itoa(i) + "\n"
+			out.Write([]byte(line))
+			expected += "slow | " + line
+		}
+		out.close()
+
+		followed, err := ioutil.ReadAll(pr)
+		c.So(err, ShouldBeNil)
+		c.So(string(followed), ShouldEqual, expected)
+
+		subscriberQueueSize = queueSize
+		os.RemoveAll(zeusDir + "/logs")
+	})
+}
+
+func TestProcessGroupShutdown(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the shutdown of process groups", t, func(c C) {
+
+		conf.Lock()
+		conf.fields.ShutdownGracePeriod = "200ms"
+		conf.Unlock()
+
+		cmd, err := cmdMap.getCommand("async-stubborn")
+		c.So(err, ShouldBeNil)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p := findProcess("async-stubborn")
+		c.So(p, ShouldNotBeNil)
+
+		// give the shell time to install the trap
+		time.Sleep(100 * time.Millisecond)
+		c.So(processGroupAlive(p.PID), ShouldBeTrue)
+
+		// the process ignores SIGTERM and is killed after the grace period
+		start := time.Now()
+		clearProcessMap()
+		c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+		c.So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+		<-p.done
+		c.So(processGroupAlive(p.PID), ShouldBeFalse)
+
+		processMapMutex.Lock()
+		c.So(p.Stopped, ShouldBeTrue)
+		c.So(p.status(), ShouldEqual, "exited (signal: killed)")
+		processMapMutex.Unlock()
+
+		deleteProcess(p.ID)
+
+		// the procs builtin escalates to SIGKILL as well
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		p = findProcess("async-stubborn")
+		c.So(p, ShouldNotBeNil)
+		time.Sleep(100 * time.Millisecond)
+
+		start = time.Now()
+		handleProcsCommand([]string{"procs", "kill", string(p.ID)})
+		c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+
+		<-p.done
+		c.So(processGroupAlive(p.PID), ShouldBeFalse)
+
+		processMapMutex.Lock()
+		c.So(p.status(), ShouldEqual, "exited (signal: killed)")
+		processMapMutex.Unlock()
+
+		deleteProcess(p.ID)
+		os.RemoveAll(zeusDir + "/logs")
+
+		conf.Lock()
+		conf.fields.ShutdownGracePeriod = "5s"
+		conf.Unlock()
+	})
+}
+
+func TestResources(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing resource accounting and limits", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("limits")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.limits, ShouldNotBeNil)
+		c.So(cmd.limits.String(), ShouldEqual, "memory 64.0MB, cpu 1s, openFiles 32")
+
+		rec := &commandRecord{Command: cmd.name}
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, rec)
+		c.So(err, ShouldBeNil)
+
+		// the limits are applied to the interpreter, the address space is not limited
+		contents, err := ioutil.ReadFile("tests/bin/limits")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "32 1 65536 unlimited\n")
+		os.Remove("tests/bin/limits")
+
+		// zeus sets the rlimits and replaces itself with the interpreter
+		execCmd, _, cleanup, err := cmd.createCommand(map[string]string{}, "", []string{}, "")
+		c.So(err, ShouldBeNil)
+		if cleanup != nil {
+			cleanup()
+		}
+		c.So(execCmd.Args[1], ShouldEqual, limitsInitArg)
+		c.So(execCmd.Args[2:5], ShouldResemble, []string{"65536", "1", "32"})
+		c.So(execCmd.Args[5], ShouldEqual, "/bin/bash")
+
+		// the resource usage is recorded
+		c.So(rec.Status, ShouldEqual, statusFinished)
+		c.So(rec.Resources, ShouldNotBeNil)
+		c.So(rec.Resources.MaxRSSKB, ShouldBeGreaterThan, 0)
+
+		// sizes
+		kb, err := parseSizeKB("1.5gb")
+		c.So(err, ShouldBeNil)
+		c.So(kb, ShouldEqual, 1572864)
+		kb, err = parseSizeKB("2048")
+		c.So(err, ShouldBeNil)
+		c.So(kb, ShouldEqual, 2)
+		_, err = parseSizeKB("lots")
+		c.So(err, ShouldNotBeNil)
+
+		c.So(formatKB(2048), ShouldEqual, "2.0MB")
+	})
+}
+
+func TestSandbox(t *testing.T) {
+
+	TestMainFunction(t)
+
+	// the sandbox requires unprivileged user namespaces
+	probe := exec.Command("true")
+	if _, err := (&sandbox{}).apply(probe, nil); err != nil {
+		t.Skip("sandbox not supported: " + err.Error())
+	}
+	if err := probe.Run(); err != nil {
+		t.Skip("user namespaces are not available: " + err.Error())
+	}
+
+	Convey("Testing sandboxed commands", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("sandboxed")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.sandbox, ShouldNotBeNil)
+		c.So(cmd.sandbox.String(), ShouldEqual, "read only filesystem, writable tests/bin/sandbox-cache/, no network")
+
+		for _, p := range []string{"tests/bin/sandbox", "tests/bin/sandbox-cache", "tests/bin/sandbox-out"} {
+			os.RemoveAll(p)
+			defer os.RemoveAll(p)
+		}
+		os.Remove("tests/bin/sandbox-forbidden")
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		// outputs and writable paths can be modified
+		contents, err := ioutil.ReadFile("tests/bin/sandbox/out")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "ok\n")
+		contents, err = ioutil.ReadFile("tests/bin/sandbox-cache/data")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "cached\n")
+
+		// output files can be replaced by renaming
+		contents, err = ioutil.ReadFile("tests/bin/sandbox-out/result")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "renamed\n")
+
+		// the rest of the project and the filesystem outside of it are read only
+		for _, p := range []string{"tests/bin/sandbox/forbidden", "tests/bin/sandbox-forbidden", "tests/bin/sandbox/outside", "../zeus-sandbox-outside", "tests/bin/sandbox/home"} {
+			_, err = os.Stat(p)
+			c.So(os.IsNotExist(err), ShouldBeTrue)
+		}
+
+		// /tmp is private
+		contents, err = ioutil.ReadFile("tests/bin/sandbox/tmp")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "zeus-sandbox-private\n")
+		_, err = os.Stat("/tmp/zeus-sandbox-private")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		// only the loopback interface exists
+		contents, err = ioutil.ReadFile("tests/bin/sandbox/interfaces")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "1\n")
+
+		// the directories of writable files are mounted, unused created directories are removed
+		sb := &sandbox{writable: []string{"tests/bin/sandbox-new/sub/file", "tests/bin/sandbox-new/sub/other"}}
+		dirs, cleanup, err := sb.prepare(nil)
+		c.So(err, ShouldBeNil)
+		abs, _ := filepath.Abs("tests/bin/sandbox-new/sub")
+		c.So(dirs, ShouldResemble, []string{abs})
+		_, err = os.Stat("tests/bin/sandbox-new/sub/file")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+		cleanup()
+		_, err = os.Stat("tests/bin/sandbox-new")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func TestArgumentModes(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the argument modes", t, func(c C) {
+
+		run := func(name string, args ...string) {
+			cmd, err := cmdMap.getCommand(name)
+			c.So(err, ShouldBeNil)
+			argBuffer, argValues, err := cmd.parseArguments(args)
+			c.So(err, ShouldBeNil)
+			err = cmd.AtomicRun(argBuffer, argValues, args, false, nil)
+			c.So(err, ShouldBeNil)
+		}
+
+		// env
+		run("argmode-env", "name=a b")
+		contents, err := ioutil.ReadFile("tests/bin/argmode")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "[] a b 80,443 name,ports\n")
+
+		// json
+		run("argmode-json", "name=a b", "ports=8080")
+		contents, err = ioutil.ReadFile("tests/bin/argmode")
+		c.So(err, ShouldBeNil)
+		fields := strings.Fields(string(contents))
+		c.So(fields, ShouldHaveLength, 2)
+		c.So(fields[0], ShouldEqual, "[]")
+
+		// the file is removed after the execution
+		_, err = os.Stat(fields[1])
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		contents, err = ioutil.ReadFile("tests/bin/argmode.json")
+		c.So(err, ShouldBeNil)
+		var data argsFile
+		c.So(json.Unmarshal(contents, &data), ShouldBeNil)
+		c.So(data.Args, ShouldResemble, map[string]interface{}{"name": "a b", "ports": []interface{}{8080.0}})
+		c.So(data.Globals["zeusComputed"], ShouldEqual, "computed")
+		c.So(data.Globals["zeusComputedInt"], ShouldEqual, 42)
+
+		os.Remove("tests/bin/argmode")
+		os.Remove("tests/bin/argmode.json")
+
+		// go commands only receive the passthrough arguments on the commandline
+		cmd, err := cmdMap.getCommand("go")
+		c.So(err, ShouldBeNil)
+		cmd.argMode = argModeEnv
+		defer func() {
+			cmd.argMode = ""
+		}()
+		command, _, _, err := cmd.createCommand(map[string]string{"url": "x"}, "", []string{"url=x", "--", "-v"}, "")
+		c.So(err, ShouldBeNil)
+		c.So(command.Args, ShouldResemble, []string{"go", "run", "zeus/go/goprogram/main.go", "-v"})
+		c.So(command.Env, ShouldContain, "ZEUS_ARG_URL=x")
+
+		c.So(validateArgMode("json", ""), ShouldBeNil)
+		c.So(validateArgMode("stdin", ""), ShouldNotBeNil)
+	})
+}
+
+func TestArgumentLiterals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the escaping of argument values", t, func(c C) {
+
+		var (
+			value  = "it's \"$(echo x)\" `id` $HOME\\n\nnext"
+			str, _ = parseArgType(argTypeString)
+			shell  = `'it'\''s "$(echo x)" ` + "`id`" + ` $HOME\n` + "\n" + `next'`
+			double = `"it's \"$(echo x)\" ` + "`id`" + ` $HOME\\n\nnext"`
+			single = `'it\'s "$(echo x)" ` + "`id`" + ` $HOME\\n` + "\n" + `next'`
+		)
+
+		// built-in languages
+		languages := map[string]*Language{
+			"bash":       bashLanguage(),
+			"sh":         shellLanguage(),
+			"zsh":        zshellLanguage(),
+			"python":     pythonLanguage(),
+			"javascript": javaScriptLanguage(),
+			"lua":        luaLanguage(),
+			"go":         goLanguage(),
+			"ruby":       rubyLanguage(),
+			"perl":       perlLanguage(),
+		}
+
+		for name, expected := range map[string]string{
+			"bash":       shell,
+			"sh":         shell,
+			"zsh":        shell,
+			"python":     double,
+			"javascript": double,
+			"lua":        double,
+			"go":         double,
+			"ruby":       single,
+			"perl":       single,
+		} {
+			c.So(str.literal(languages[name].literalSyntax(), value), ShouldEqual, expected)
+		}
+
+		// quotes mark a string and are not part of the value
+		c.So(str.literal("bash", `"a b"`), ShouldEqual, `'a b'`)
+
+		b, _ := parseArgType(argTypeBool)
+		c.So(b.literal("python", "true"), ShouldEqual, "True")
+		c.So(b.literal("perl", "false"), ShouldEqual, "0")
+		i, _ := parseArgType(argTypeInt)
+		c.So(i.literal("python", "42"), ShouldEqual, "42")
+
+		// the assignments are executed by the interpreters that are available
+		for name, script := range map[string][]string{
+			"bash":       {"bash", "-c", `printf %s "$v"`},
+			"sh":         {"sh", "-c", `printf %s "$v"`},
+			"perl":       {"perl", "-e", `print $v;`},
+			"javascript": {"node", "-e", `process.stdout.write(v)`},
+		} {
+			if _, err := exec.LookPath(script[0]); err != nil {
+				continue
+			}
+			lang := languages[name]
+			assignment := lang.VariableKeyword + "v" + lang.AssignmentOperator + str.literal(lang.literalSyntax(), value) + lang.LineDelimiter + "\n"
+			out, err := exec.Command(script[0], script[1], assignment+script[2]).Output()
+			c.So(err, ShouldBeNil)
+			c.So(string(out), ShouldEqual, value)
+		}
+
+		// arguments of commands
+		cmd, err := cmdMap.getCommand("python")
+		c.So(err, ShouldBeNil)
+		argBuffer, _, err := cmd.parseArguments([]string{"src=a b", "dst='c'"})
+		c.So(err, ShouldBeNil)
+		c.So(argBuffer, ShouldEqual, "src = \"a b\"\ndst = \"c\"\n")
+	})
+}
+
+func TestVariadicArguments(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing variadic arguments", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("variadic-args")
+		c.So(err, ShouldBeNil)
+
+		for _, args := range [][]string{
+			{"pkg=a", "pkg=b", "pkg=c"},
+			{"a", "b", "c"},
+			{"--pkg", "a", "--pkg=b", "pkg=c"},
+		} {
+			argBuffer, argValues, err := cmd.parseArguments(args)
+			c.So(err, ShouldBeNil)
+			c.So(argValues, ShouldResemble, map[string]string{"pkg": `["a","b","c"]`, "count": `["1","2"]`})
+			c.So(argBuffer, ShouldContainSubstring, "pkg=('a' 'b' 'c')")
+		}
+
+		_, argValues, err := cmd.parseArguments([]string{"a", "count=3", "count=4"})
+		c.So(err, ShouldBeNil)
+		c.So(argValues["count"], ShouldEqual, `["3","4"]`)
+
+		// every value is a single element, commas and whitespace are preserved
+		argBuffer, argValues, err := cmd.parseArguments([]string{"pkg=a,b", " c "})
+		c.So(err, ShouldBeNil)
+		c.So(argBuffer, ShouldContainSubstring, "pkg=('a,b' ' c ')")
+		c.So(decodeList(argValues["pkg"]), ShouldResemble, []string{"a,b", " c "})
+		c.So(cmd.joinArgs(argValues)["pkg"], ShouldEqual, "a,b, c ")
+		c.So(cmd.args[0].argType.typedValue(argValues["pkg"]), ShouldResemble, []interface{}{"a,b", " c "})
+		c.So(cmd.args[1].argType.typedValue(argValues["count"]), ShouldResemble, []interface{}{int64(1), int64(2)})
+		out, err := cmd.expandArgs("tests/bin/${pkg}", argValues)
+		c.So(err, ShouldBeNil)
+		c.So(out, ShouldResemble, []string{"tests/bin/a,b", "tests/bin/ c "})
+		_, _, err = cmd.parseArguments([]string{"a", "count=1,2"})
+		c.So(err, ShouldNotBeNil)
+
+		_, _, err = cmd.parseArguments([]string{"a", "count=x"})
+		c.So(err, ShouldNotBeNil)
+		_, _, err = cmd.parseArguments([]string{"count=3"})
+		c.So(err, ShouldNotBeNil)
+
+		// expansion in outputs and dependencies
+		out, err = cmd.expandArgs("tests/bin/${pkg}-${count}", map[string]string{"pkg": "a,b", "count": "1,2"})
+		c.So(err, ShouldBeNil)
+		c.So(out, ShouldResemble, []string{"tests/bin/a-1", "tests/bin/a-2", "tests/bin/b-1", "tests/bin/b-2"})
+		out, err = cmd.expandArgs("tests/bin/${pkg}", map[string]string{"pkg": ""})
+		c.So(err, ShouldBeNil)
+		c.So(out, ShouldBeEmpty)
+
+		os.Remove("tests/bin/variadic-deps")
+		err = cmd.Run([]string{"a", "b"}, false)
+		c.So(err, ShouldBeNil)
+
+		contents, err := ioutil.ReadFile("tests/bin/variadic")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "a b 1 2\n")
+		contents, err = ioutil.ReadFile("tests/bin/variadic-deps")
+		c.So(err, ShouldBeNil)
+		c.So(string(contents), ShouldEqual, "a\nb\n")
+		for _, file := range []string{"tests/bin/variadic", "tests/bin/variadic-deps", "tests/bin/variadic-a", "tests/bin/variadic-b"} {
+			_, err = os.Stat(file)
+			c.So(err, ShouldBeNil)
+			os.Remove(file)
+		}
+
+		// help and completion
+		c.So(argUsage(cmd.name, cmd.args), ShouldEqual, "variadic-args <pkg...> [count...] [-- args...]")
+		c.So(argCompletions(cmd.args, "variadic-args pkg=a "), ShouldContain, "pkg=")
+	})
+}
+
+func TestPromptArguments(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing prompting for missing arguments", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("prompt-args")
+		c.So(err, ShouldBeNil)
+
+		var (
+			inputs  []string
+			secrets []bool
+			read    = func(prompt string, secret bool) (string, error) {
+				if len(inputs) == 0 {
+					return "", ErrPromptCancelled
+				}
+				v := inputs[0]
+				inputs = inputs[1:]
+				secrets = append(secrets, secret)
+				return v, nil
+			}
+		)
+
+		// invalid and empty values are asked for again, enum values can be chosen by number
+		inputs = []string{"3", "2", "", "s3cr3t-arg", ""}
+		args, err := cmd.promptArgs([]string{}, read)
+		c.So(err, ShouldBeNil)
+		c.So(args, ShouldResemble, []string{"env=prod", "token=s3cr3t-arg"})
+		c.So(secrets, ShouldResemble, []bool{false, false, true, true, false})
+
+		// supplied arguments are kept, passthrough arguments are preserved
+		inputs = []string{"tok", "v2"}
+		args, err = cmd.promptArgs([]string{"dev", "--", "-v"}, read)
+		c.So(err, ShouldBeNil)
+		c.So(args, ShouldResemble, []string{"env=dev", "token=tok", "tag=v2", "--", "-v"})
+
+		// nothing is asked if the required arguments are present
+		inputs = []string{}
+		args, err = cmd.promptArgs([]string{"dev", "tok"}, read)
+		c.So(err, ShouldBeNil)
+		c.So(args, ShouldResemble, []string{"dev", "tok"})
+
+		_, err = cmd.promptArgs([]string{"dev"}, read)
+		c.So(err, ShouldEqual, ErrPromptCancelled)
+
+		// missing arguments of dependencies are asked for when resolving the graph
+		deps, err := cmdMap.getCommand("prompt-deps")
+		c.So(err, ShouldBeNil)
+
+		dg := newDepGraph()
+		_, err = dg.addRoot(deps, []string{})
+		c.So(err, ShouldNotBeNil)
+
+		dg = newDepGraph()
+		dg.read = read
+		inputs = []string{"dep-token", "v3"}
+		n, err := dg.addRoot(deps, []string{})
+		c.So(err, ShouldBeNil)
+		c.So(n.deps, ShouldHaveLength, 1)
+		c.So(n.deps[0].argValues, ShouldResemble, map[string]string{"env": "dev", "token": "dep-token", "tag": "v3"})
+
+		// and for all commands of a chain
+		inputs = []string{"1", "chain-token", "", "dep-token", ""}
+		dg, err = commandChain{cmd, deps}.graph([]string{"prompt-args", "prompt-deps"}, read)
+		c.So(err, ShouldBeNil)
+		c.So(dg.nodes, ShouldHaveLength, 3)
+		c.So(dg.nodes[0].argValues["token"], ShouldEqual, "chain-token")
+		c.So(dg.nodes[1].argValues["token"], ShouldEqual, "dep-token")
+		c.So(inputs, ShouldBeEmpty)
+
+		// without a terminal, the chain is rejected
+		_, ok := validCommandChain([]string{"prompt-args"}, true)
+		c.So(ok, ShouldBeFalse)
+		c.So(shellPrompt(), ShouldBeNil)
+
+		// stdin is not a terminal
+		args, err = cmd.promptMissingArgs([]string{})
+		c.So(err, ShouldBeNil)
+		c.So(args, ShouldBeEmpty)
+		_, _, err = cmd.parseArguments(args)
+		c.So(err, ShouldNotBeNil)
+
+		// secret arguments are masked
+		_, argValues, err := cmd.parseArguments([]string{"dev", "s3cr3t-arg"})
+		c.So(err, ShouldBeNil)
+		c.So(maskSecrets("token="+argValues["token"]), ShouldEqual, "token="+secretMask)
+	})
+}
+
+func TestPositionalArguments(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing positional arguments and flags", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("flag-args")
+		c.So(err, ShouldBeNil)
+
+		for _, args := range [][]string{
+			{"prod", "v2", "-f", "--replicas", "3"},
+			{"--force", "-r=3", "prod", "v2"},
+			{"env=prod", "--tag=v2", "--force=true", "-r", "3"},
+		} {
+			_, argValues, err := cmd.parseArguments(args)
+			c.So(err, ShouldBeNil)
+			c.So(argValues, ShouldResemble, map[string]string{"env": "prod", "tag": "v2", "force": "true", "replicas": "3"})
+		}
+
+		// negative numbers are values
+		_, argValues, err := cmd.parseArguments([]string{"dev", "-r", "-2"})
+		c.So(err, ShouldBeNil)
+		c.So(argValues["replicas"], ShouldEqual, "-2")
+		c.So(argValues["tag"], ShouldEqual, "latest")
+
+		// everything after -- is passed to the script
+		rawArgs := []string{"prod", "-f", "--", "--tag", "b c"}
+		argBuffer, argValues, err := cmd.parseArguments(rawArgs)
+		c.So(err, ShouldBeNil)
+		err = cmd.AtomicRun(argBuffer, argValues, rawArgs, false, nil)
+		c.So(err, ShouldBeNil)
+		contents, err := ioutil.ReadFile("tests/bin/flags")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/flags")
+		c.So(string(contents), ShouldEqual, "prod latest true 1 2 --tag b c\n")
+
+		for _, args := range [][]string{
+			{"prod", "v2", "extra"},
+			{"prod", "--nope"},
+			{"prod", "--replicas"},
+			{"--env", "dev", "env=prod"},
+		} {
+			_, _, err = cmd.parseArguments(args)
+			c.So(err, ShouldNotBeNil)
+		}
+
+		// help and completion
+		c.So(argUsage(cmd.name, cmd.args), ShouldEqual, "flag-args <env> [tag] [--force|-f] [replicas] [-- args...]")
+		c.So(argCompletions(cmd.args, "flag-args --env "), ShouldResemble, []string{"dev", "prod"})
+		c.So(argCompletions(cmd.args, "flag-args prod --"), ShouldResemble, []string{"--tag", "--force", "--replicas", "--", commandChainSeparator})
+		c.So(argCompletions(cmd.args, "flag-args prod -- "), ShouldBeEmpty)
+	})
+}
+
+func TestArgumentTypes(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing argument types", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("typed-args")
+		c.So(err, ShouldBeNil)
+
+		argBuffer, argValues, err := cmd.parseArguments([]string{"env=prod", "hosts=alpha,beta"})
+		c.So(err, ShouldBeNil)
+		c.So(argBuffer, ShouldContainSubstring, "hosts=('alpha' 'beta')")
+		c.So(argBuffer, ShouldContainSubstring, "ports=(80 443)")
+
+		err = cmd.AtomicRun(argBuffer, argValues, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+		contents, err := ioutil.ReadFile("tests/bin/args")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/args")
+		c.So(string(contents), ShouldEqual, "prod beta 80 tests 30s v1.0\n")
+
+		// errors name the failed constraint
+		for args, msg := range map[string]string{
+			"env=test":                    "must be one of: dev, staging, prod",
+			"ports=80,http":               "element 2 (http)",
+			"dir=tests/zeus/commands.yml": "path is not a directory",
+			"dir=tests/missing":           "path does not exist",
+			"timeout=5":                   "invalid duration",
+			"tag=v":                       "length 1 is below the minimum of 2",
+			"tag=v1.0.0.0.00":             "length 11 exceeds the maximum of 10",
+			"tag=release":                 "does not match the pattern",
+		} {
+			_, _, err = cmd.parseArguments([]string{"hosts=a", args})
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, msg)
+		}
+
+		// declarations
+		cf := &CommandsFile{}
+		for _, decl := range []string{"a:Enum()", "a:List<List<Int>>", "a:Path(socket)", "a:String(/[/)", "a:Int(1..2)", "a:Int? = abc", "a:Enum(x|y)? = z"} {
+			_, err = cf.validateArgs([]string{decl})
+			c.So(err, ShouldNotBeNil)
+		}
+		args, err := cf.validateArgs([]string{"a:String(/^(x|y)=?$/)? = x="})
+		c.So(err, ShouldBeNil)
+		c.So(args[0].argType.pattern.String(), ShouldEqual, "^(x|y)=?$")
+		c.So(args[0].defaultValue, ShouldEqual, " x=")
+
+		// lists in the native form of the language
+		list, _ := parseArgType("List<String>")
+		c.So(list.literal("python", "a,b"), ShouldEqual, `["a", "b"]`)
+		c.So(list.literal("lua", ""), ShouldEqual, `{}`)
+
+		// completions
+		c.So(argCompletions(cmd.args, "typed-args e"), ShouldContain, "env=staging")
+		c.So(argCompletions(cmd.args, "typed-args env=dev dir=tests/ze"), ShouldContain, "dir=tests/zeus/")
+		c.So(argCompletions(cmd.args, "typed-args env=dev hosts=a "), ShouldContain, commandChainSeparator)
+	})
+}
+
+func TestComputedGlobals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing computed globals", t, func(c C) {
+
+		c.So(g.Vars["zeusComputed"], ShouldEqual, "computed")
+		c.So(g.Vars["zeusComputedInt"], ShouldEqual, "42")
+		c.So(g.Values["zeusComputedInt"].typ, ShouldEqual, globalInt)
+
+		cmd, err := cmdMap.getCommand("computed-globals")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.outputs, ShouldResemble, []string{"tests/bin/computed"})
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+		contents, err := ioutil.ReadFile("tests/bin/computed")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/computed")
+		c.So(string(contents), ShouldEqual, "computed 42 lazy\n")
+
+		// globals with a ttl are evaluated lazily and cached until the ttl expired
+		lazy := g.Values["zeusLazy"]
+		evaluated := lazy.evaluated
+		c.So(g.refresh(), ShouldBeNil)
+		c.So(lazy.evaluated, ShouldEqual, evaluated)
+
+		lazy.evaluated = time.Now().Add(-2 * time.Hour)
+		c.So(g.refresh(), ShouldBeNil)
+		c.So(lazy.evaluated, ShouldHappenAfter, evaluated)
+
+		// a map with a shell key is kept if the Map type is declared
+		gl, err := parseGlobal("cmds:Map", &globalValue{shape: shapeComputed, shell: "make", dict: map[string]string{"shell": "make"}})
+		c.So(err, ShouldBeNil)
+		c.So(gl.typ, ShouldEqual, globalMap)
+
+		// errors are reported with the line of the declaration
+		commandsFile, err := ioutil.ReadFile(commandsFilePath)
+		c.So(err, ShouldBeNil)
+		line := findGlobalLine(string(commandsFile), "zeusComputedInt:Int")
+		c.So(strings.Split(string(commandsFile), "\n")[line-1], ShouldContainSubstring, "zeusComputedInt:Int:")
+
+		gl, err = parseGlobal("broken:Int", &globalValue{shape: shapeComputed, shell: "echo nope"})
+		c.So(err, ShouldBeNil)
+		gl.source = "commands.yml:3: "
+		c.So(gl.evaluate().Error(), ShouldStartWith, "commands.yml:3: global broken: invalid output")
+
+		gl, err = parseGlobal("broken", &globalValue{shape: shapeComputed, shell: "echo fail >&2; exit 3"})
+		c.So(err, ShouldBeNil)
+		c.So(gl.evaluate().Error(), ShouldEndWith, "failed: exit status 3: fail")
+
+		// expired globals are evaluated while parallel commands read the globals
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					g.Lock()
+					g.Values["zeusLazy"].evaluated = time.Time{}
+					g.Unlock()
+					g.refresh()
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					vars, _ := g.snapshot()
+					(&envData{}).environ(vars)
+					generateGlobals(bashLanguage(), "")
+				}
+			}()
+		}
+		wg.Wait()
+
+		vars, _ := g.snapshot()
+		c.So(vars["zeusLazy"], ShouldEqual, "lazy")
+	})
+}
+
+func TestErrorLine(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the line numbers of errors", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("error-line")
+		c.So(err, ShouldBeNil)
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldNotBeNil)
+
+		// the line in the error refers to the line in the dump
+		contents, err := ioutil.ReadFile("tests/zeus/dumps/error_dump.sh")
+		c.So(err, ShouldBeNil)
+		m := regexp.MustCompile(`line (\d+): zeus-undefined-command`).FindStringSubmatch(string(contents))
+		c.So(m, ShouldNotBeNil)
+		n, err := strconv.Atoi(m[1])
+		c.So(err, ShouldBeNil)
+		c.So(strings.Split(string(contents), "\n")[n-1], ShouldEqual, "zeus-undefined-command")
+
+		// only the globals used by the command are declared
+		c.So(string(contents), ShouldNotContainSubstring, "zeusLazy")
+		code := globalCode(bashLanguage(), "echo $zeusLazy")
+		c.So(code, ShouldContainSubstring, "zeusLazy=")
+		c.So(code, ShouldNotContainSubstring, "zeusComputed=")
+	})
+}
+
+func TestSecrets(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing secrets", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("secret-args")
+		c.So(err, ShouldBeNil)
+
+		// the values are passed to the script
+		argBuffer, argValues, err := cmd.parseArguments([]string{})
+		c.So(err, ShouldBeNil)
+		c.So(argValues["token"], ShouldEqual, "s3cr3t-token")
+
+		// events only contain the masked values
+		ev := &executionEvent{Type: eventStart, Command: cmd.name, Args: argValues}
+		emitEvent(ev)
+		c.So(ev.Args["token"], ShouldEqual, secretMask)
+		c.So(argValues["token"], ShouldEqual, "s3cr3t-token")
+
+		err = cmd.AtomicRun(argBuffer, argValues, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+		contents, err := ioutil.ReadFile("tests/bin/secrets")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/secrets")
+		c.So(string(contents), ShouldEqual, "s3cr3t-token s3cr3t-token\n")
+
+		// invocation keys are masked in the hashes file and the run history
+		c.So(recordHash(cmd.name, argValues, nil, "hash"), ShouldBeNil)
+		info, err := os.Stat("tests/zeus/hashes.yml")
+		c.So(err, ShouldBeNil)
+		c.So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		contents, err = ioutil.ReadFile("tests/zeus/hashes.yml")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/zeus/hashes.yml")
+		c.So(string(contents), ShouldNotContainSubstring, "s3cr3t-token")
+		c.So(string(contents), ShouldContainSubstring, secretMask)
+
+		dg := newDepGraph()
+		n, err := dg.add(cmd, []string{})
+		c.So(err, ShouldBeNil)
+		c.So(n.label, ShouldNotContainSubstring, "s3cr3t-token")
+		c.So(n.key, ShouldContainSubstring, "s3cr3t-token")
+
+		// the values are masked in the output
+		c.So(maskSecrets("token: s3cr3t-token"), ShouldEqual, "token: "+secretMask)
+
+		var buf bytes.Buffer
+		out := Log.Out
+		Log.Out = &buf
+		Log.WithField("token", "s3cr3t-token").Info("using s3cr3t-token")
+		Log.WithFields(logrus.Fields{
+			"args":   []string{"--token", "s3cr3t-token"},
+			"values": map[string]string{"token": "s3cr3t-token"},
+			"nested": map[string]interface{}{"token": []interface{}{"s3cr3t-token"}},
+			"other":  struct{ Token string }{"s3cr3t-token"},
+		}).Info("running")
+		Log.Out = out
+		c.So(buf.String(), ShouldNotContainSubstring, "s3cr3t-token")
+		c.So(buf.String(), ShouldContainSubstring, secretMask)
+
+		// encrypted secrets file
+		enc, err := encryptSecrets(map[string]string{"apiKey": "k3y-from-file"}, "correct horse")
+		c.So(err, ShouldBeNil)
+		_, err = decryptSecrets(enc, "wrong")
+		c.So(err, ShouldNotBeNil)
+
+		path := "tests/zeus/test-secrets.enc"
+		c.So(ioutil.WriteFile(path, enc, 0600), ShouldBeNil)
+		defer os.Remove(path)
+
+		os.Setenv(secretsPassphraseEnv, "correct horse")
+		defer os.Unsetenv(secretsPassphraseEnv)
+
+		err = secrets.add(map[string]*secretData{
+			"fileSecret": {Provider: "file", File: path, Key: "apiKey"},
+		})
+		c.So(err, ShouldBeNil)
+		v, err := resolveSecrets("key=${secret:fileSecret}")
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "key=k3y-from-file")
+		c.So(maskSecrets(v), ShouldEqual, "key="+secretMask)
+
+		// validation
+		_, err = resolveSecrets("${secret:missing}")
+		c.So(err, ShouldNotBeNil)
+		c.So(secrets.add(map[string]*secretData{"bad": {Provider: "vault"}}), ShouldNotBeNil)
+		c.So(secrets.add(map[string]*secretData{"bad": {Provider: "exec"}}), ShouldNotBeNil)
+	})
+}
+
+func TestTypedGlobals(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing typed globals", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("typed-globals")
+		c.So(err, ShouldBeNil)
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		contents, err := ioutil.ReadFile("tests/bin/globals")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/globals")
+		c.So(string(contents), ShouldEqual, "8080 0.5 beta backend 2 it's \"quoted\" $HOME\n")
+
+		// lists and maps are passed as JSON via the environment
+		c.So(g.Vars["zeusHosts"], ShouldEqual, `["alpha","beta"]`)
+		c.So(g.Vars["zeusLabels"], ShouldEqual, `{"replicas":2,"tier":"backend"}`)
+
+		// literals
+		quoted := g.Values["zeusQuoted"]
+		c.So(pythonLanguage().declareGlobal(quoted), ShouldEqual, `zeusQuoted = "it's \"quoted\" $HOME"`)
+		c.So(rubyLanguage().declareGlobal(quoted), ShouldEqual, `$zeusQuoted = 'it\'s "quoted" $HOME'`)
+		c.So(bashLanguage().declareGlobal(quoted), ShouldEqual, `zeusQuoted='it'\''s "quoted" $HOME'`)
+
+		hosts := g.Values["zeusHosts"]
+		c.So(bashLanguage().declareGlobal(hosts), ShouldEqual, `zeusHosts=('alpha' 'beta')`)
+		c.So(luaLanguage().declareGlobal(hosts), ShouldEqual, `local zeusHosts = {"alpha", "beta"}`)
+		c.So(shellLanguage().declareGlobal(hosts), ShouldEqual, `zeusHosts='["alpha","beta"]'`)
+
+		labels := g.Values["zeusLabels"]
+		c.So(bashLanguage().declareGlobal(labels), ShouldEqual, `declare -A zeusLabels=(['replicas']=2 ['tier']='backend')`)
+		c.So(pythonLanguage().declareGlobal(labels), ShouldEqual, `zeusLabels = {"replicas": 2, "tier": "backend"}`)
+		c.So(rubyLanguage().declareGlobal(labels), ShouldEqual, `$zeusLabels = {'replicas' => 2, 'tier' => 'backend'}`)
+		c.So(luaLanguage().declareGlobal(labels), ShouldEqual, `local zeusLabels = {["replicas"] = 2, ["tier"] = "backend"}`)
+
+		c.So(pythonLanguage().declareGlobal(&globalVar{name: "ok", typ: globalBool, value: "true"}), ShouldEqual, "ok = True")
+		c.So(perlLanguage().declareGlobal(g.Values["zeusRatio"]), ShouldEqual, "$zeusRatio = 0.5;")
+		c.So(doubleQuote("a\tb\x01"), ShouldEqual, `"a\tb\x01"`)
+
+		// validation
+		_, err = parseGlobal("port:Int", &globalValue{shape: shapeScalar, scalar: "http"})
+		c.So(err, ShouldNotBeNil)
+		_, err = parseGlobal("hosts:List", &globalValue{shape: shapeScalar, scalar: "alpha"})
+		c.So(err, ShouldNotBeNil)
+		_, err = parseGlobal("port:Port", &globalValue{shape: shapeScalar, scalar: "80"})
+		c.So(err, ShouldNotBeNil)
+		_, err = parseGlobal("my-var", &globalValue{shape: shapeScalar, scalar: "x"})
+		c.So(err, ShouldNotBeNil)
+
+		// untyped scalars
+		gl, err := parseGlobal("count", &globalValue{shape: shapeScalar, scalar: "3"})
+		c.So(err, ShouldBeNil)
+		c.So(gl.typ, ShouldEqual, globalInt)
+		gl, err = parseGlobal("version", &globalValue{shape: shapeScalar, scalar: "0.8"})
+		c.So(err, ShouldBeNil)
+		c.So(gl.typ, ShouldEqual, globalString)
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the environment policy", t, func(c C) {
+
+		os.Setenv("ZEUS_TEST_ALLOWED_1", "yes")
+		os.Setenv("ZEUS_TEST_DENIED", "no")
+		defer os.Unsetenv("ZEUS_TEST_ALLOWED_1")
+		defer os.Unsetenv("ZEUS_TEST_DENIED")
+
+		cmd, err := cmdMap.getCommand("env-clean")
+		c.So(err, ShouldBeNil)
+		c.So(cmd.environment().String(), ShouldEqual, "clean, allow PATH ZEUS_TEST_ALLOWED*, files tests/zeus/test.env, 2 vars, globals prefix ZEUS_")
+
+		err = cmd.AtomicRun("", map[string]string{}, []string{}, false, nil)
+		c.So(err, ShouldBeNil)
+
+		contents, err := ioutil.ReadFile("tests/bin/env")
+		c.So(err, ShouldBeNil)
+		os.Remove("tests/bin/env")
+
+		env := "\n" + string(contents)
+		c.So(env, ShouldContainSubstring, "\nPATH=")
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_ALLOWED_1=yes\n")
+		c.So(env, ShouldNotContainSubstring, "ZEUS_TEST_DENIED")
+
+		// globals are prefixed
+		c.So(env, ShouldContainSubstring, "\nZEUS_binaryName=zeus\n")
+		c.So(env, ShouldNotContainSubstring, "\nbinaryName=")
+
+		// files and vars of the commandsFile and the command
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_FILE=from file\n")
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_QUOTED=single # not a comment\n")
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_PLAIN=plain\n")
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_PROJECT=project\n")
+		c.So(env, ShouldContainSubstring, "\nZEUS_TEST_VAR=yes-var\n")
+
+		// the environment is inherited by default
+		inherited, err := mergeEnv(nil, nil).environ(map[string]string{"name": "value"})
+		c.So(err, ShouldBeNil)
+		c.So(inherited, ShouldContain, "ZEUS_TEST_DENIED=no")
+		c.So(inherited, ShouldContain, "name=value")
+
+		c.So((&envData{Mode: "hermetic"}).validate("for command test"), ShouldNotBeNil)
+		_, err = (&envData{Files: []string{"tests/zeus/missing.env"}}).environ(nil)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDependencyGraph(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the dependency graph", t, func(c C) {
+
+		cmd, err := cmdMap.getCommand("diamond")
+		c.So(err, ShouldBeNil)
+
+		// the shared dependency must only be added once
+		dg := newDepGraph()
+		_, err = dg.addRoot(cmd, []string{})
+		c.So(err, ShouldBeNil)
+		c.So(len(dg.nodes), ShouldEqual, 4)
+		c.So(dg.nodes[0].cmd.name, ShouldEqual, "diamond-base")
+		c.So(dg.nodes[3].cmd.name, ShouldEqual, "diamond")
+
+		// different argument values produce different invocations
+		base, err := cmdMap.getCommand("diamond-base")
+		c.So(err, ShouldBeNil)
+		_, err = dg.addRoot(base, []string{"name=other"})
+		c.So(err, ShouldBeNil)
+		c.So(len(dg.nodes), ShouldEqual, 5)
+
+		// dependencies are shared across a command chain
+		chain, ok := validCommandChain([]string{"diamond-left", "diamond-right"}, false)
+		c.So(ok, ShouldBeTrue)
+		dg, err = chain.graph([]string{"diamond-left", "diamond-right"}, nil)
+		c.So(err, ShouldBeNil)
+		c.So(len(dg.nodes), ShouldEqual, 3)
+		c.So(dg.exec(), ShouldBeNil)
+		s.reset()
+	})
+}
+
+func TestScheduler(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the parallel scheduler", t, func(c C) {
+
+		// run a command and return the lines written by the steps
+		run := func(name string, jobs int) ([]string, error) {
+
+			defer os.Remove("tests/bin/sched")
+			parallelFlag = jobs
+			defer func() {
+				parallelFlag = 0
+			}()
+
+			cmd, err := cmdMap.getCommand(name)
+			c.So(err, ShouldBeNil)
+
+			dg := newDepGraph()
+			_, err = dg.addRoot(cmd, []string{})
+			c.So(err, ShouldBeNil)
+			err = dg.exec()
+			s.reset()
+
+			contents, _ := ioutil.ReadFile("tests/bin/sched")
+			if len(contents) == 0 {
+				return nil, err
+			}
+			return strings.Split(strings.TrimSpace(string(contents)), "\n"), err
+		}
+
+		// highest number of steps running at the same time
+		concurrency := func(lines []string) (max int) {
+			var running int
+			for _, line := range lines {
+				if strings.HasPrefix(line, "start ") {
+					running++
+				} else if strings.HasPrefix(line, "end ") {
+					running--
+				}
+				if running > max {
+					max = running
+				}
+			}
+			return max
+		}
+
+		// dependencies finish before their dependents start
+		lines, err := run("sched", 3)
+		c.So(err, ShouldBeNil)
+		c.So(len(lines), ShouldEqual, 7)
+		c.So(lines[6], ShouldEqual, "root")
+		c.So(concurrency(lines), ShouldEqual, 3)
+
+		// the number of parallel commands is limited
+		lines, err = run("sched", 2)
+		c.So(err, ShouldBeNil)
+		c.So(lines[6], ShouldEqual, "root")
+		c.So(concurrency(lines), ShouldEqual, 2)
+
+		lines, err = run("sched", 1)
+		c.So(err, ShouldBeNil)
+		c.So(lines, ShouldResemble, []string{"start a", "end a", "start b", "end b", "start c", "end c", "root"})
+
+		// no new commands are started after a command with stopOnError failed
+		lines, err = run("sched-fail", 1)
+		c.So(err, ShouldNotBeNil)
+		c.So(lines, ShouldBeEmpty)
+
+		// without stopOnError the independent commands are still executed
+		broken, err := cmdMap.getCommand("sched-broken")
+		c.So(err, ShouldBeNil)
+		stopOnError, disabled := broken.stopOnError, false
+		broken.stopOnError = &disabled
+		lines, err = run("sched-fail", 1)
+		c.So(err, ShouldNotBeNil)
+		c.So(lines, ShouldResemble, []string{"start after", "end after"})
+		broken.stopOnError = stopOnError
+
+		// only commands executed one at a time own the terminal
+		parallelFlag = 2
+		c.So(canOwnTerminal(false), ShouldBeFalse)
+		parallelFlag = 1
+		c.So(canOwnTerminal(false), ShouldBeTrue)
+		c.So(canOwnTerminal(true), ShouldBeFalse)
+		parallelFlag = 0
+
+		// with parallel scheduling Ctrl-C is passed to all running commands
+		go func() {
+			for {
+				processMapMutex.Lock()
+				var running int
+				for _, p := range processMap {
+					if p.Name == "sched-step" {
+						running++
+					}
+				}
+				processMapMutex.Unlock()
+				if running == 3 {
+					passSignalToProcs(syscall.SIGINT)
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		lines, err = run("sched", 3)
+		c.So(err, ShouldNotBeNil)
+		c.So(concurrency(lines), ShouldEqual, 3)
+		c.So(lines, ShouldNotContain, "root")
+		for _, line := range lines {
+			c.So(line, ShouldStartWith, "start ")
+		}
+	})
+}
+
+func TestCycleDetection(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing dependency cycle detection", t, func(c C) {
+
+		// restore the commands of the tests
+		defer func() {
+			_, err := parseCommandsFile(commandsFilePath, true)
+			c.So(err, ShouldBeNil)
+		}()
+
+		// the commandsFile is rejected and the cycle is reported
+		_, err := parseCommandsFile("tests/zeus/cycles/cycle.yml", true)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, "dependency cycle detected: cycle-a -> cycle-b -> cycle-a")
+
+		// a cycle between an extended and the extending commandsFile is detected after merging them,
+		// like it is done for extends and includes: the base is parsed first, the project without flushing the commands
+		_, err = parseCommandsFile("tests/zeus/cycles/project.yml", true)
+		c.So(err, ShouldBeNil)
+		_, err = parseCommandsFile("tests/zeus/cycles/base.yml", true)
+		c.So(err, ShouldBeNil)
+		_, err = parseCommandsFile("tests/zeus/cycles/project.yml", false)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldEqual, "dependency cycle detected: base-build -> project-generate -> base-build")
+
+		// each dependency is located in the commandsFile that declared it
+		base, err := filepath.Abs("tests/zeus/cycles/base.yml")
+		c.So(err, ShouldBeNil)
+		project, err := filepath.Abs("tests/zeus/cycles/project.yml")
+		c.So(err, ShouldBeNil)
+
+		cmdMap.Lock()
+		file, line := findDependencyDeclaration("project-generate", "base-build")
+		c.So(file, ShouldEqual, project)
+		c.So(line, ShouldEqual, 7)
+		file, line = findDependencyDeclaration("base-build", "project-generate")
+		c.So(file, ShouldEqual, base)
+		c.So(line, ShouldEqual, 6)
+
+		// inherited dependencies are located in the commandsFile of the base command
+		cmdMap.items["project-build"] = &command{name: "project-build", extends: "base-build", source: project}
+		file, line = findDependencyDeclaration("project-build", "project-generate")
+		c.So(file, ShouldEqual, base)
+		c.So(line, ShouldEqual, 6)
+		delete(cmdMap.items, "project-build")
+
+		// unknown declarations have no location
+		_, line = findDependencyDeclaration("project-generate", "unknown")
+		c.So(line, ShouldEqual, -1)
+		cmdMap.Unlock()
+
+		items := map[string]*command{
+			"a": {name: "a", dependencies: []string{"b name=test"}},
+			"b": {name: "b", dependencies: []string{"c", "unknown"}},
+			"c": {name: "c"},
+		}
+		c.So(findCycle(items), ShouldBeNil)
+
+		// close the cycle
+		items["c"].dependencies = []string{"a"}
+		c.So(findCycle(items), ShouldResemble, []string{"a", "b", "c", "a"})
+
+		contents := "commands:\n    a:\n        exec: echo\n    c:\n        dependencies:\n            - b\n            - a\n"
+		c.So(findDependencyLine(contents, "c", "a"), ShouldEqual, 7)
+		c.So(findDependencyLine(contents, "a", "a"), ShouldEqual, -1)
+	})
+}
+
+func TestGraph(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the graph builtin", t, func(c C) {
+
+		dg, err := resolveGraph("diamond")
+		c.So(err, ShouldBeNil)
+
+		var b bytes.Buffer
+		c.So(dg.write(&b, "ascii"), ShouldBeNil)
+		c.So(b.String(), ShouldStartWith, "diamond [bash]\n")
+		c.So(b.String(), ShouldContainSubstring, "└── diamond-base name=base [bash]")
+
+		b.Reset()
+		c.So(dg.write(&b, "dot"), ShouldBeNil)
+		c.So(b.String(), ShouldContainSubstring, "n3 -> n1;")
+
+		b.Reset()
+		c.So(dg.write(&b, "mermaid"), ShouldBeNil)
+		c.So(b.String(), ShouldContainSubstring, "n1 --> n0")
+
+		b.Reset()
+		c.So(dg.write(&b, "json"), ShouldBeNil)
+		c.So(b.String(), ShouldContainSubstring, `"command": "diamond-base"`)
+
+		c.So(dg.write(&b, "svg"), ShouldNotBeNil)
+
+		handleLine("graph mermaid diamond-left -> diamond-right")
+	})
+}
+
+func TestExplain(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing the explain builtin", t, func(c C) {
+
+		c.So(explain("diamond-left -> diamond-right"), ShouldBeNil)
+		c.So(explain("diamond-base --unknown"), ShouldNotBeNil)
+		c.So(explain("unknown"), ShouldNotBeNil)
+
+		// nothing must have been executed
+		_, err := os.Stat("tests/bin/dependency1")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+		c.So(explain("dependency1"), ShouldBeNil)
+		_, err = os.Stat("tests/bin/dependency1")
+		c.So(os.IsNotExist(err), ShouldBeTrue)
+
+		handleLine("explain diamond")
+
+		// explain does not touch the filesystem:
+		// no sandbox directories, argument files or temporary scripts are created
+		dirs := []string{"tests/bin", scriptDir + "/.tmp"}
+		modTimes := make([]time.Time, len(dirs))
+		for i, dir := range dirs {
+			c.So(os.MkdirAll(dir, 0700), ShouldBeNil)
+			info, err := os.Stat(dir)
+			c.So(err, ShouldBeNil)
+			modTimes[i] = info.ModTime()
+		}
+
+		c.So(explain("sandboxed"), ShouldBeNil)
+		c.So(explain("argmode-json name=explain"), ShouldBeNil)
+
+		for i, dir := range dirs {
+			info, err := os.Stat(dir)
+			c.So(err, ShouldBeNil)
+			c.So(info.ModTime(), ShouldEqual, modTimes[i])
+		}
+	})
+}
+
+func TestExecutionEvents(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing execution events", t, func(c C) {
+
+		path := "tests/bin/events.jsonl"
+
+		conf.Lock()
+		conf.fields.EventStream = path
+		conf.Unlock()
+
+		handleLine("diamond-base name=events")
+
+		conf.Lock()
+		conf.fields.EventStream = ""
+		conf.Unlock()
+
+		contents, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+
+		lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+		c.So(len(lines), ShouldEqual, 2)
+
+		var e executionEvent
+		c.So(json.Unmarshal([]byte(lines[0]), &e), ShouldBeNil)
+		c.So(e.Type, ShouldEqual, eventStart)
+		c.So(e.Command, ShouldEqual, "diamond-base")
+		c.So(e.Args["name"], ShouldEqual, "events")
+		c.So(e.PID, ShouldBeGreaterThan, 0)
+
+		c.So(json.Unmarshal([]byte(lines[1]), &e), ShouldBeNil)
+		c.So(e.Type, ShouldEqual, eventFinish)
+		c.So(*e.ExitCode, ShouldEqual, 0)
+
+		c.So(tail("a\nb\nc\n", 2), ShouldEqual, "b\nc")
+
+		// only text and json are valid log formats
+		c.So(validateLogFormat("json"), ShouldBeNil)
+		c.So(validateLogFormat("text"), ShouldBeNil)
+		c.So(validateLogFormat("jsn"), ShouldNotBeNil)
+
+		conf.setValue("logFormat", "jsn")
+		conf.Lock()
+		c.So(conf.fields.LogFormat, ShouldEqual, "text")
+		conf.Unlock()
+
+		dir, err := ioutil.TempDir("", "zeus-config")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		c.So(ioutil.WriteFile(dir+"/config.yml", []byte("logFormat: jsn\n"), 0600), ShouldBeNil)
+
+		projectDir := zeusDir
+		zeusDir = dir
+		_, _, err = parseProjectConfig()
+		zeusDir = projectDir
+		projectConfigPath = zeusDir + "/config.yml"
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "invalid log format: jsn")
+
+		os.Remove(path)
+	})
+}
+
+func TestReport(t *testing.T) {
+
+	TestMainFunction(t)
+
+	Convey("Testing run history and reports", t, func(c C) {
+
+		handleLine("diamond")
+		handleLine("diamond-left -> diamond-right")
+
+		runs, err := loadRuns(2)
+		c.So(err, ShouldBeNil)
+		c.So(len(runs), ShouldEqual, 2)
+		c.So(runs[0].Invocation, ShouldEqual, "diamond")
+		c.So(runs[0].Success, ShouldBeTrue)
+		c.So(len(runs[0].Commands), ShouldEqual, 4)
+		c.So(runs[0].Commands[0].Status, ShouldEqual, statusFinished)
+		c.So(runs[1].Invocation, ShouldEqual, "diamond-left -> diamond-right")
+
+		for _, format := range []string{"terminal", "markdown", "html"} {
+			var b bytes.Buffer
+			c.So(writeReport(&b, runs, format), ShouldBeNil)
+			c.So(b.String(), ShouldContainSubstring, "diamond-base")
+		}
+
+		// user controlled values are escaped
+		runs = append(runs, &runRecord{Invocation: "<script>alert(1)</script> [x](javascript:alert(1)) a|b"})
+		var b bytes.Buffer
+		c.So(writeReport(&b, runs, "html"), ShouldBeNil)
+		c.So(b.String(), ShouldNotContainSubstring, "<script>")
+		c.So(b.String(), ShouldNotContainSubstring, "href=\"javascript")
+		c.So(b.String(), ShouldContainSubstring, "&lt;script&gt;alert(1)&lt;/script&gt;")
+		b.Reset()
+		c.So(writeReport(&b, runs, "markdown"), ShouldBeNil)
+		c.So(b.String(), ShouldContainSubstring, `\<script\>alert(1)\</script\> \[x\](javascript:alert(1)) a\|b`)
+
+		handleLine("report markdown 5")
+
+		rec := httptest.NewRecorder()
+		reportHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/report?runs=2", nil))
+		c.So(rec.Code, ShouldEqual, http.StatusOK)
+		c.So(rec.Body.String(), ShouldContainSubstring, "Slowest commands")
+
+		os.Remove("tests/zeus/runs.jsonl")
+	})
+}
+
 func TestCommandsFile(t *testing.T) {
 
 	TestMainFunction(t)
@@ -3,14 +3,55 @@ package zeusutils
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 )
 
-// LoadArg attempts to load the named zeus argument from os.Args.
-// Args are passed to zeus commands in the name=value format on the commandline.
+// environment variables set by zeus for commands with argMode env or json
+const (
+	argEnvPrefix = "ZEUS_ARG_"
+	argNamesEnv  = "ZEUS_ARGS"
+	argsFileEnv  = "ZEUS_ARGS_FILE"
+)
+
+// ArgsFile contains the typed arguments and globals of a command with argMode json.
+// Lists are decoded as []interface{}, numbers as float64.
+type ArgsFile struct {
+	Args    map[string]interface{} `json:"args"`
+	Globals map[string]interface{} `json:"globals"`
+}
+
+// ReadArgsFile reads the file with the arguments and globals, whose path zeus passes in ZEUS_ARGS_FILE.
+// Returns nil if the variable is not set.
+func ReadArgsFile() (*ArgsFile, error) {
+
+	path := os.Getenv(argsFileEnv)
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f ArgsFile
+	err = json.Unmarshal(contents, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// LoadArg attempts to load the named zeus argument.
+// Args are passed to zeus commands in the name=value format on the commandline,
+// as ZEUS_ARG_<NAME> environment variables with argMode env,
+// or in the file from ZEUS_ARGS_FILE with argMode json.
 // Zeus will throw an error if not all required args are provided to your command,
 // so this util does not validate the presence of args, but only loads the value.
 // In addition, leading and trailing whitespace will be trimmed.
@@ -23,12 +64,33 @@ func LoadArg(name string) string {
 			}
 		}
 	}
-	return ""
+	if val, ok := os.LookupEnv(argEnvPrefix + strings.ToUpper(name)); ok {
+		return strings.TrimSpace(val)
+	}
+	return LoadArgs()[name]
 }
 
 // LoadArgs loads all zeus arguments into a map, with the argument label as keys.
+// Lists are joined with commas.
 func LoadArgs() map[string]string {
 	args := make(map[string]string)
+
+	f, err := ReadArgsFile()
+	if err != nil {
+		log.Fatal("failed to read arguments file: ", err)
+	}
+	if f != nil {
+		for name, val := range f.Args {
+			args[name] = strings.TrimSpace(formatValue(val))
+		}
+	}
+
+	if names := os.Getenv(argNamesEnv); names != "" {
+		for _, name := range strings.Split(names, ",") {
+			args[name] = strings.TrimSpace(os.Getenv(argEnvPrefix + strings.ToUpper(name)))
+		}
+	}
+
 	for _, arg := range os.Args {
 		parts := strings.SplitN(arg, "=", 2)
 		if len(parts) == 2 {
@@ -38,6 +100,28 @@ func LoadArgs() map[string]string {
 	return args
 }
 
+// format a value from the arguments file as it would be passed on the commandline
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			elems[i] = formatValue(e)
+		}
+		return strings.Join(elems, ",")
+	}
+	b, _ := json.Marshal(val)
+	return string(b)
+}
+
 // RequireEnv attempts to load the value of the named environment variable
 // If no value for the given name has been found, the program will fatal.
 func RequireEnv(name string) string {
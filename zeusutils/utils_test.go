@@ -4,6 +4,7 @@ import (
 	"github.com/dreadl0ck/zeus/zeusutils"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -35,6 +36,36 @@ func TestLoadArgs(t *testing.T) {
 	}
 }
 
+func TestLoadArgsEnv(t *testing.T) {
+	os.Args = []string{"zeus"}
+	os.Setenv("ZEUS_ARGS", "srcDir,ports")
+	os.Setenv("ZEUS_ARG_SRCDIR", "a b")
+	os.Setenv("ZEUS_ARG_PORTS", "80,443")
+	defer os.Unsetenv("ZEUS_ARGS")
+	defer os.Unsetenv("ZEUS_ARG_SRCDIR")
+	defer os.Unsetenv("ZEUS_ARG_PORTS")
+
+	assert.Equal(t, map[string]string{"srcDir": "a b", "ports": "80,443"}, zeusutils.LoadArgs())
+	assert.Equal(t, "a b", zeusutils.LoadArg("srcDir"))
+}
+
+func TestLoadArgsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "args.json")
+	err := os.WriteFile(path, []byte(`{"args": {"name": "a b", "count": 3, "ok": true, "ports": [80, 443]}, "globals": {"version": "1.0"}}`), 0600)
+	assert.NoError(t, err)
+
+	os.Args = []string{"zeus"}
+	os.Setenv("ZEUS_ARGS_FILE", path)
+	defer os.Unsetenv("ZEUS_ARGS_FILE")
+
+	assert.Equal(t, map[string]string{"name": "a b", "count": "3", "ok": "true", "ports": "80,443"}, zeusutils.LoadArgs())
+	assert.Equal(t, "3", zeusutils.LoadArg("count"))
+
+	f, err := zeusutils.ReadArgsFile()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0", f.Globals["version"])
+}
+
 func TestRequireEnv(t *testing.T) {
 	// $PATH should always be set
 	_ = zeusutils.RequireEnv("PATH")